@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+)
+
+// backgroundAnchors maps background_align values to imaging anchor points
+var backgroundAnchors = map[string]imaging.Anchor{
+	"center":       imaging.Center,
+	"top":          imaging.Top,
+	"bottom":       imaging.Bottom,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"top-left":     imaging.TopLeft,
+	"top-right":    imaging.TopRight,
+	"bottom-left":  imaging.BottomLeft,
+	"bottom-right": imaging.BottomRight,
+}
+
+// renderReport collects facts about a render that are returned as response headers.
+// A nil *renderReport is valid and records nothing.
+type renderReport struct {
+	backgroundCrop image.Rectangle // part of the background image shown, in its own pixels
+	placement      image.Rectangle // where the code sits in the final image, set by layout
+}
+
+// anchorOffset returns where a box of size inner sits inside outer at the anchor
+func anchorOffset(outer, inner image.Point, anchor imaging.Anchor) image.Point {
+	x, y := (outer.X-inner.X)/2, (outer.Y-inner.Y)/2
+	switch anchor {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		x = 0
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		x = outer.X - inner.X
+	}
+	switch anchor {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		y = 0
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		y = outer.Y - inner.Y
+	}
+	return image.Pt(x, y)
+}
+
+// fitBackground scales the photo onto a canvas of the given size. "cover" fills the canvas
+// and crops the overflow at the anchor, "contain" shows the whole photo placed at the
+// anchor over bg, and "stretch" distorts it to the canvas. It also returns the part of the
+// photo that ends up visible.
+func fitBackground(photo image.Image, size image.Point, fit string, anchor imaging.Anchor, bg color.Color) (*image.NRGBA, image.Rectangle) {
+	source := photo.Bounds().Size()
+	switch fit {
+	case "contain":
+		fitted := imaging.Fit(photo, size.X, size.Y, imaging.Lanczos)
+		canvas := imaging.New(size.X, size.Y, bg)
+		offset := anchorOffset(size, fitted.Bounds().Size(), anchor)
+		draw.Draw(canvas, fitted.Bounds().Add(offset), fitted, image.Point{}, draw.Over)
+		return canvas, image.Rectangle{Max: source}
+	case "stretch":
+		return imaging.Resize(photo, size.X, size.Y, imaging.Lanczos), image.Rectangle{Max: source}
+	default:
+		// The crop keeps the canvas aspect ratio at the largest size the photo allows
+		scale := min(float64(source.X)/float64(size.X), float64(source.Y)/float64(size.Y))
+		crop := image.Pt(int(float64(size.X)*scale), int(float64(size.Y)*scale))
+		origin := anchorOffset(source, crop, anchor)
+		return imaging.Fill(photo, size.X, size.Y, anchor, imaging.Lanczos), image.Rectangle{Min: origin, Max: origin.Add(crop)}
+	}
+}
+
+// applyBackgroundImage shows the photo through the light areas of the code. Each photo
+// pixel is lightened or darkened away from the foreground by the same contrast guard as
+// gradients, so the modules stay readable over busy photos.
+func applyBackgroundImage(img, mask image.Image, fg color.Color, photo image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isForeground(mask.At(x, y), fg) {
+				continue
+			}
+			c, _ := ensureContrast(photo.At(x-bounds.Min.X, y-bounds.Min.Y), fg, minModuleContrast)
+			result.Set(x, y, c)
+		}
+	}
+	return result
+}
+
+// formatRect renders a rectangle as "x,y,width,height"
+func formatRect(r image.Rectangle) string {
+	return fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+// sideBorders holds the quiet zone width in modules and the fill color of each side
+type sideBorders struct {
+	top, right, bottom, left int
+	colors                   [4]string // top, right, bottom, left; empty uses the background
+}
+
+// resolveSideBorders returns the per-side borders, with unset sides taking border,
+// and reports whether any side was set, which requires the asymmetric rendering path
+func resolveSideBorders(options QRCodeOptions) (sideBorders, bool) {
+	side := func(n int) int {
+		if n < 0 {
+			return options.Border
+		}
+		return n
+	}
+	b := sideBorders{
+		top:    side(options.BorderTop),
+		right:  side(options.BorderRight),
+		bottom: side(options.BorderBottom),
+		left:   side(options.BorderLeft),
+		colors: [4]string{options.BorderTopColor, options.BorderRightColor, options.BorderBottomColor, options.BorderLeftColor},
+	}
+	set := options.BorderTop >= 0 || options.BorderRight >= 0 || options.BorderBottom >= 0 || options.BorderLeft >= 0
+	for _, c := range b.colors {
+		set = set || c != ""
+	}
+	return b, set
+}
+
+// symbolSize returns the pixel size to render the bare symbol at so that, once the
+// per-side borders are added, the longer side of the image is options.Size
+func (b sideBorders) symbolSize(qr *qrcode.QRCode, size int) int {
+	symbol := len(qr.Bitmap())
+	longest := max(symbol+b.left+b.right, symbol+b.top+b.bottom)
+	size = max(size, longest)
+	return symbol * size / longest
+}
+
+// validate rejects borders that leave too little of either axis for the modules
+func (b sideBorders) validate(qr *qrcode.QRCode) error {
+	symbol := len(qr.Bitmap())
+	for _, axis := range []struct {
+		name       string
+		start, end int
+	}{{"border_left and border_right", b.left, b.right}, {"border_top and border_bottom", b.top, b.bottom}} {
+		if (axis.start+axis.end)*100 >= (symbol+axis.start+axis.end)*maxBorderPercent {
+			return fiber.NewError(400, fmt.Sprintf("%s take %d of %d modules; they must stay below %d%% of the image size",
+				axis.name, axis.start+axis.end, symbol+axis.start+axis.end, maxBorderPercent))
+		}
+	}
+	return nil
+}
+
+// apply surrounds img, which holds the bare symbol of the given module count, with the
+// per-side borders. Each side is filled with its color, or bg when it has none; the top
+// and bottom strips span the full width.
+func (b sideBorders) apply(img image.Image, modules int, bg color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	unit := float64(bounds.Dx()) / float64(modules)
+	px := func(n int) int { return int(math.Round(float64(n) * unit)) }
+	top, right, bottom, left := px(b.top), px(b.right), px(b.bottom), px(b.left)
+
+	result := image.NewRGBA(image.Rect(0, 0, left+bounds.Dx()+right, top+bounds.Dy()+bottom))
+	w, h := result.Bounds().Dx(), result.Bounds().Dy()
+	rects := [4]image.Rectangle{
+		image.Rect(0, 0, w, top),
+		image.Rect(w-right, top, w, h-bottom),
+		image.Rect(0, h-bottom, w, h),
+		image.Rect(0, top, left, h-bottom),
+	}
+	for i, r := range rects {
+		fill := bg
+		if b.colors[i] != "" {
+			fill = parseColor(b.colors[i])
+		}
+		draw.Draw(result, r, image.NewUniform(fill), image.Point{}, draw.Src)
+	}
+	draw.Draw(result, image.Rect(left, top, left+bounds.Dx(), top+bounds.Dy()), img, bounds.Min, draw.Src)
+
+	return result
+}
+
+// applyBleed surrounds the finished image with a solid margin of bleed pixels on every
+// side, for print trimming. Transparent areas of img are left showing the bleed color.
+func applyBleed(img image.Image, bleed int, bleedColor color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx()+2*bleed, bounds.Dy()+2*bleed))
+	draw.Draw(result, result.Bounds(), image.NewUniform(bleedColor), image.Point{}, draw.Src)
+	draw.Draw(result, image.Rect(bleed, bleed, bleed+bounds.Dx(), bleed+bounds.Dy()), img, bounds.Min, draw.Over)
+	return result
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSideBordersAsymmetricMargins(t *testing.T) {
+	options := testOptions("hello")
+	options.BorderTop, options.BorderRight, options.BorderBottom, options.BorderLeft = 0, 2, 6, 4
+	options.BorderRightColor = "red"
+	// 27 modules on both axes at ten pixels each
+	options.Size = 270
+	img := renderCode(t, options)
+
+	if img.Bounds() != image.Rect(0, 0, 270, 270) {
+		t.Fatalf("image is %v, want 270x270", img.Bounds())
+	}
+	if modules, want := moduleBounds(img, color.Black), image.Rect(40, 0, 250, 210); modules != want {
+		t.Errorf("modules span %v, want %v", modules, want)
+	}
+	if got := color.RGBAModel.Convert(img.At(265, 100)); got != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("right margin is %v, want red", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(100, 265)); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("bottom margin is %v, want the background", got)
+	}
+}
+
+func TestSideBordersUnsetSidesTakeBorder(t *testing.T) {
+	options := testOptions("hello")
+	options.Border = 3
+	options.BorderLeft = 0
+	sides, set := resolveSideBorders(options)
+	if !set {
+		t.Fatal("border_left=0 did not select per-side borders")
+	}
+	if sides.top != 3 || sides.right != 3 || sides.bottom != 3 || sides.left != 0 {
+		t.Errorf("sides = %d %d %d %d, want 3 3 3 0", sides.top, sides.right, sides.bottom, sides.left)
+	}
+}
+
+func TestSideBordersRejectWideAxis(t *testing.T) {
+	options := testOptions("hello")
+	options.BorderLeft, options.BorderRight = 10, 10
+	if _, err := prepareOptions(&options); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := generateImage(options, nil, nil); err == nil {
+		t.Error("20 modules of border around a 21 module symbol were accepted")
+	}
+}
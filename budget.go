@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// minBudgetQuality is the lowest JPEG quality tried before downscaling
+const minBudgetQuality = 10
+
+// budgetScaleStep is the factor the image shrinks by on each downscaling attempt
+const budgetScaleStep = 0.85
+
+// fitByteBudget re-encodes the image until it fits in max_bytes. JPEG output first steps its
+// quality down to minBudgetQuality; after that, and for PNG from the start, the image is
+// downscaled until it fits or would drop below one pixel per module, which returns 413.
+func fitByteBudget(img image.Image, options QRCodeOptions) ([]byte, image.Image, []string, error) {
+	var warnings []string
+	qr, err := newQRCode(options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	modules := len(moduleMatrix(qr, options.Border))
+
+	var body []byte
+	if options.Format == "jpeg" {
+		for options.Quality > minBudgetQuality {
+			options.Quality = max(minBudgetQuality, options.Quality-10)
+			if body, _, err = encodeImage(img, options); err != nil {
+				return nil, nil, nil, err
+			}
+			if len(body) <= options.MaxBytes {
+				return body, img, append(warnings, fmt.Sprintf("quality lowered to %d to fit max_bytes", options.Quality)), nil
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("quality lowered to %d to fit max_bytes", options.Quality))
+	}
+
+	// Nearest neighbor keeps module edges sharp, which matters more than smoothness at small sizes
+	bounds := img.Bounds()
+	for scale := budgetScaleStep; ; scale *= budgetScaleStep {
+		width, height := int(float64(bounds.Dx())*scale), int(float64(bounds.Dy())*scale)
+		if min(width, height) < modules {
+			return nil, nil, warnings, fiber.NewError(413, fmt.Sprintf("output cannot fit in max_bytes=%d without dropping below one pixel per module", options.MaxBytes))
+		}
+		scaled := imaging.Resize(img, width, height, imaging.NearestNeighbor)
+		if body, _, err = encodeImage(scaled, options); err != nil {
+			return nil, nil, nil, err
+		}
+		if len(body) <= options.MaxBytes {
+			return body, scaled, append(warnings, fmt.Sprintf("image downscaled to %dx%d to fit max_bytes", width, height)), nil
+		}
+	}
+}
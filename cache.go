@@ -0,0 +1,233 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// cache holds rendered responses shared by all requests
+var cache Cache = noCache{}
+
+// Cache keeps rendered responses keyed by the hash of their normalized options.
+// Implementations treat every failure as a miss, so a broken cache only costs renders.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// newCache creates the backend selected by the configuration
+func newCache(cfg Config) (Cache, error) {
+	switch cfg.CacheBackend {
+	case "none":
+		return noCache{}, nil
+	case "memory":
+		return newMemoryCache(cfg.CacheEntries, cfg.CacheBytes), nil
+	case "redis":
+		return newRedisCache(cfg.RedisURL, cfg.CacheTTL)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.CacheBackend)
+	}
+}
+
+// cachedOutput is a rendered response as stored in the cache
+type cachedOutput struct {
+	ContentType string   `json:"content_type"`
+	Body        []byte   `json:"body"`
+	Warnings    []string `json:"warnings,omitempty"`
+	Width       int      `json:"width,omitempty"` // final raster dimensions, 0 for matrix formats
+	Height      int      `json:"height,omitempty"`
+
+	BackgroundCrop string `json:"background_crop,omitempty"` // "x,y,width,height" of the visible background photo
+	Placement      string `json:"placement,omitempty"`       // "x,y,width,height" of the code within a layout
+
+	LogoSize float64 `json:"logo_size,omitempty"` // logo_size safe=true shrank the logo to, 0 when unchanged
+}
+
+// cacheKey hashes the normalized options, so requests spelling the same code differently share an entry
+func cacheKey(options QRCodeOptions) string {
+	normalized, _ := json.Marshal(struct {
+		QRCodeOptions
+		NoWatermark bool `json:"no_watermark"`
+	}{options, options.noWatermark})
+	sum := sha256.Sum256(normalized)
+	return "qr:v1:" + hex.EncodeToString(sum[:])
+}
+
+// lookupOutput returns the cached response for the key, if any
+func lookupOutput(key string) (cachedOutput, bool) {
+	value, ok := cache.Get(key)
+	if !ok {
+		return cachedOutput{}, false
+	}
+	var out cachedOutput
+	if err := json.Unmarshal(value, &out); err != nil {
+		return cachedOutput{}, false
+	}
+	return out, true
+}
+
+// bypassCache reports whether the request skips the response cache, with no_cache=true
+// or a Cache-Control: no-store request header
+func bypassCache(c *fiber.Ctx) bool {
+	if c.QueryBool("no_cache") {
+		return true
+	}
+	for _, directive := range strings.Split(c.Get(fiber.HeaderCacheControl), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+// storeOutput caches the response under the key
+func storeOutput(key string, out cachedOutput) {
+	if value, err := json.Marshal(out); err == nil {
+		cache.Set(key, value)
+	}
+}
+
+// noCache stores nothing
+type noCache struct{}
+
+func (noCache) Get(string) ([]byte, bool) { return nil, false }
+func (noCache) Set(string, []byte)        {}
+
+// memoryCache keeps the most recently used entries in process memory, up to a number of
+// entries and a total size in bytes; it is not shared between instances
+type memoryCache struct {
+	mu       sync.Mutex
+	limit    int
+	maxBytes int
+	bytes    int        // total size of the cached values
+	order    *list.List // most recently used first
+	entries  map[string]*list.Element
+}
+
+// memoryEntry is the list element value of a memoryCache entry
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+func newMemoryCache(limit, maxBytes int) *memoryCache {
+	return &memoryCache{limit: max(1, limit), maxBytes: max(1, maxBytes), order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	// A value larger than the whole budget would only evict everything else
+	if len(value) > c.maxBytes {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, value: value})
+	c.bytes += len(value)
+	for c.order.Len() > c.limit || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops an entry; the caller holds the lock
+func (c *memoryCache) remove(element *list.Element) {
+	entry := element.Value.(*memoryEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.value)
+}
+
+// redisTimeout bounds every cache round trip so a slow Redis cannot hold up renders
+const redisTimeout = 100 * time.Millisecond
+
+// redisBackoff is how long the cache is bypassed after Redis fails
+const redisBackoff = 30 * time.Second
+
+// redisCache shares entries between instances through Redis. When Redis is unreachable
+// it logs the error and behaves like noCache until the backoff expires.
+type redisCache struct {
+	client    *redis.Client
+	ttl       time.Duration
+	downUntil atomic.Int64 // unix nanoseconds before which Redis is skipped
+}
+
+func newRedisCache(url string, ttl time.Duration) (*redisCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	c := &redisCache{client: redis.NewClient(opts), ttl: ttl}
+
+	// An unreachable Redis at startup is not fatal; the cache stays off until it answers
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		c.fail(err)
+	}
+	return c, nil
+}
+
+// available reports whether the backoff after the last failure has expired
+func (c *redisCache) available() bool {
+	return time.Now().UnixNano() >= c.downUntil.Load()
+}
+
+// fail logs the error and bypasses Redis for the backoff period
+func (c *redisCache) fail(err error) {
+	if c.available() {
+		log.Printf("redis cache unavailable, caching disabled for %s: %v", redisBackoff, err)
+	}
+	c.downUntil.Store(time.Now().Add(redisBackoff).UnixNano())
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool) {
+	if !c.available() {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			c.fail(err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *redisCache) Set(key string, value []byte) {
+	if !c.available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := c.client.Set(ctx, key, value, c.ttl).Err(); err != nil {
+		c.fail(err)
+	}
+}
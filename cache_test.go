@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemoryCacheByteBudget(t *testing.T) {
+	c := newMemoryCache(10, 100)
+	c.Set("a", make([]byte, 40))
+	c.Set("b", make([]byte, 40))
+	c.Get("a")
+	// Going past the budget evicts the least recently used entry
+	c.Set("c", make([]byte, 40))
+	if _, ok := c.Get("b"); ok {
+		t.Error("b kept past the byte budget")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	if c.bytes != 80 {
+		t.Errorf("%d bytes counted, want 80", c.bytes)
+	}
+
+	// A value larger than the whole budget is not kept and evicts nothing
+	c.Set("huge", make([]byte, 101))
+	if _, ok := c.Get("huge"); ok {
+		t.Error("value above the budget was cached")
+	}
+	if c.order.Len() != 2 {
+		t.Errorf("%d entries left, want 2", c.order.Len())
+	}
+
+	// Replacing an entry recounts its size
+	c.Set("a", make([]byte, 10))
+	if c.bytes != 50 {
+		t.Errorf("%d bytes counted after replacing a, want 50", c.bytes)
+	}
+}
+
+func TestCachedResponseKeepsOnlyRenderWarnings(t *testing.T) {
+	previous := cache
+	cache = newMemoryCache(8, 1<<20)
+	defer func() { cache = previous }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Get("/generate", handleGenerate)
+	get := func(query string) (status, warnings string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/generate?data=hello"+query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get("X-QR-Cache"), resp.Header.Get("X-QR-Warnings")
+	}
+
+	// ec_overlay is dropped before the cache key is taken, so both requests share an entry
+	if status, warnings := get("&ec_overlay=true"); status != "miss" || !strings.Contains(warnings, "ec_overlay ignored") {
+		t.Fatalf("first request: cache %q, warnings %q", status, warnings)
+	}
+	if status, warnings := get(""); status != "hit" || strings.Contains(warnings, "ec_overlay ignored") {
+		t.Fatalf("second request: cache %q, warnings %q", status, warnings)
+	}
+}
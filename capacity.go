@@ -0,0 +1,185 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+// dataCodewords lists the number of data codewords for versions 1-40, indexed by recovery level
+var dataCodewords = [4][40]int{
+	qrcode.Low: {19, 34, 55, 80, 108, 136, 156, 194, 232, 274, 324, 370, 428, 461, 523, 589, 647, 721, 795, 861,
+		932, 1006, 1094, 1174, 1276, 1370, 1468, 1531, 1631, 1735, 1843, 1955, 2071, 2191, 2306, 2434, 2566, 2702, 2812, 2956},
+	qrcode.Medium: {16, 28, 44, 64, 86, 108, 124, 154, 182, 216, 254, 290, 334, 365, 415, 453, 507, 563, 627, 669,
+		714, 782, 860, 914, 1000, 1062, 1128, 1193, 1267, 1373, 1455, 1541, 1631, 1725, 1812, 1914, 1992, 2102, 2216, 2334},
+	qrcode.High: {13, 22, 34, 48, 62, 76, 88, 110, 132, 154, 180, 206, 244, 261, 295, 325, 367, 397, 445, 485,
+		512, 568, 614, 664, 718, 754, 808, 871, 911, 985, 1033, 1115, 1171, 1231, 1286, 1354, 1426, 1502, 1582, 1666},
+	qrcode.Highest: {9, 16, 26, 36, 46, 60, 66, 86, 100, 122, 140, 158, 180, 197, 223, 253, 283, 313, 341, 385,
+		406, 442, 464, 514, 538, 596, 628, 661, 701, 745, 793, 845, 901, 961, 986, 1054, 1096, 1142, 1222, 1276},
+}
+
+// totalCodewords returns the number of data and error correction codewords in a version
+func totalCodewords(version int) int {
+	modules := (16*version+128)*version + 64
+	if version >= 2 {
+		// Alignment patterns, minus their overlap with the timing patterns
+		align := version/7 + 2
+		modules -= (25*align-10)*align - 55
+		if version >= 7 {
+			// Version information blocks
+			modules -= 36
+		}
+	}
+	return modules / 8
+}
+
+// recoverableCodewords returns how many codewords the error correction can restore
+func recoverableCodewords(level qrcode.RecoveryLevel, version int) int {
+	return (totalCodewords(version) - dataCodewords[level][version-1]) / 2
+}
+
+// charCountBits returns the width of the character count indicator for a mode and version
+func charCountBits(mode string, version int) int {
+	bits := map[string][3]int{
+		"numeric":      {10, 12, 14},
+		"alphanumeric": {9, 11, 13},
+		"byte":         {8, 16, 16},
+		"kanji":        {8, 10, 12},
+	}[mode]
+
+	switch {
+	case version <= 9:
+		return bits[0]
+	case version <= 26:
+		return bits[1]
+	default:
+		return bits[2]
+	}
+}
+
+// maxDataLength returns how many characters of the given mode fit in a version at a recovery level
+func maxDataLength(level qrcode.RecoveryLevel, mode string, version int) int {
+	// 4 bits of mode indicator precede the character count and the data
+	remaining := dataCodewords[level][version-1]*8 - 4 - charCountBits(mode, version)
+
+	switch mode {
+	case "numeric":
+		// 3 digits per 10 bits, a trailing 1 or 2 digits take 4 or 7 bits
+		n := remaining / 10 * 3
+		switch rest := remaining % 10; {
+		case rest >= 7:
+			n += 2
+		case rest >= 4:
+			n++
+		}
+		return n
+	case "alphanumeric":
+		// 2 characters per 11 bits, a trailing character takes 6 bits
+		n := remaining / 11 * 2
+		if remaining%11 >= 6 {
+			n++
+		}
+		return n
+	case "kanji":
+		return remaining / 13
+	default:
+		return remaining / 8
+	}
+}
+
+// isValidErrorLevel reports whether level is one of the supported error correction letters
+func isValidErrorLevel(level string) bool {
+	switch level {
+	case "L", "M", "Q", "H":
+		return true
+	default:
+		return false
+	}
+}
+
+// alphanumericCharset holds the characters the QR alphanumeric mode can encode
+const alphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// fitsEncodingMode reports whether every character of data can be encoded in the mode.
+// byte and auto accept any data.
+func fitsEncodingMode(data, mode string) bool {
+	switch mode {
+	case "numeric":
+		return strings.Trim(data, "0123456789") == ""
+	case "alphanumeric":
+		return strings.Trim(data, alphanumericCharset) == ""
+	default:
+		return true
+	}
+}
+
+// capacityModes lists the data modes reported by the capacity endpoint
+var capacityModes = []string{"numeric", "alphanumeric", "byte", "kanji"}
+
+// handleCapacity returns QR data capacities. With mode set it lists the maximum data
+// length per version for one error level (M by default); without mode it breaks the
+// capacity down by error level and mode. version and error narrow the result.
+func handleCapacity(c *fiber.Ctx) error {
+	level := c.Query("error")
+	mode := c.Query("mode")
+	version := c.QueryInt("version", 0)
+
+	if level != "" && !isValidErrorLevel(level) {
+		return c.Status(400).JSON(fiber.Map{"error": "error must be one of L, M, Q, H"})
+	}
+
+	if mode != "" && !slices.Contains(capacityModes, mode) {
+		return c.Status(400).JSON(fiber.Map{"error": "mode must be one of numeric, alphanumeric, byte, kanji"})
+	}
+
+	if c.Query("version") != "" && (version < 1 || version > 40) {
+		return c.Status(400).JSON(fiber.Map{"error": "version must be between 1 and 40"})
+	}
+
+	first, last := 1, 40
+	if version != 0 {
+		first, last = version, version
+	}
+
+	levels := []string{"L", "M", "Q", "H"}
+	if level != "" {
+		levels = []string{level}
+	} else if mode != "" {
+		level = "M"
+	}
+
+	versions := make([]fiber.Map, 0, last-first+1)
+	for v := first; v <= last; v++ {
+		entry := fiber.Map{
+			"version": v,
+			"modules": 17 + v*4,
+		}
+
+		if mode != "" {
+			entry["max_length"] = maxDataLength(getErrorCorrection(level), mode, v)
+		} else {
+			capacity := fiber.Map{}
+			for _, l := range levels {
+				byMode := fiber.Map{}
+				for _, m := range capacityModes {
+					byMode[m] = maxDataLength(getErrorCorrection(l), m, v)
+				}
+				capacity[l] = byMode
+			}
+			entry["capacity"] = capacity
+		}
+
+		versions = append(versions, entry)
+	}
+
+	if mode != "" {
+		return c.JSON(fiber.Map{
+			"error_level": level,
+			"mode":        mode,
+			"versions":    versions,
+		})
+	}
+	return c.JSON(fiber.Map{"versions": versions})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestMaxDataLength(t *testing.T) {
+	// Capacities from ISO/IEC 18004 table 7
+	tests := []struct {
+		level   qrcode.RecoveryLevel
+		mode    string
+		version int
+		want    int
+	}{
+		{qrcode.Low, "numeric", 1, 41},
+		{qrcode.Low, "alphanumeric", 1, 25},
+		{qrcode.Low, "byte", 1, 17},
+		{qrcode.Low, "kanji", 1, 10},
+		{qrcode.Highest, "byte", 1, 7},
+		{qrcode.High, "alphanumeric", 7, 125},
+		{qrcode.Medium, "byte", 10, 213},
+		{qrcode.Medium, "numeric", 27, 2701},
+		{qrcode.Low, "numeric", 40, 7089},
+		{qrcode.Low, "alphanumeric", 40, 4296},
+		{qrcode.Low, "byte", 40, 2953},
+		{qrcode.Low, "kanji", 40, 1817},
+		{qrcode.Highest, "byte", 40, 1273},
+	}
+	for _, tt := range tests {
+		if got := maxDataLength(tt.level, tt.mode, tt.version); got != tt.want {
+			t.Errorf("maxDataLength(%d, %s, %d) = %d, want %d", tt.level, tt.mode, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestTotalCodewords(t *testing.T) {
+	for version, want := range map[int]int{1: 26, 2: 44, 6: 172, 7: 196, 14: 581, 21: 1156, 40: 3706} {
+		if got := totalCodewords(version); got != want {
+			t.Errorf("totalCodewords(%d) = %d, want %d", version, got, want)
+		}
+	}
+}
+
+func TestByteCapacityMatchesEncoder(t *testing.T) {
+	for _, level := range []qrcode.RecoveryLevel{qrcode.Low, qrcode.Medium, qrcode.High, qrcode.Highest} {
+		for version := 1; version <= 40; version++ {
+			limit := maxDataLength(level, "byte", version)
+			if _, err := qrcode.NewWithForcedVersion(strings.Repeat("a", limit), version, level); err != nil {
+				t.Errorf("level %d version %d: %d bytes did not fit: %v", level, version, limit, err)
+			}
+			if _, err := qrcode.NewWithForcedVersion(strings.Repeat("a", limit+1), version, level); err == nil {
+				t.Errorf("level %d version %d: %d bytes fit, above the reported capacity", level, version, limit+1)
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// applyCard composites the QR code centered on a rounded-rectangle card with transparent corners
+func applyCard(img image.Image, cardColor color.Color, radius, padding int) *image.RGBA {
+	qrSize := img.Bounds().Size()
+	width, height := qrSize.X+2*padding, qrSize.Y+2*padding
+
+	card := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Draw the card shape through the rounded-rect mask, leaving the corners transparent
+	mask := roundedRectMask(width, height, radius)
+	draw.DrawMask(card, card.Bounds(), image.NewUniform(cardColor), image.Point{}, mask, image.Point{}, draw.Over)
+
+	// Draw the QR code centered inside the padding
+	qrPos := image.Rect(padding, padding, padding+qrSize.X, padding+qrSize.Y)
+	draw.Draw(card, qrPos, img, img.Bounds().Min, draw.Over)
+
+	return card
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+)
+
+// maxLayoutSide is the largest width or height the circular layout may produce
+const maxLayoutSide = 8192
+
+// circularLayoutSide returns the diameter of the circular frame around a w x h code.
+// The code's corners sit ringGap inside the frame so the border never touches them.
+func circularLayoutSide(w, h, border int) int {
+	return int(math.Ceil(math.Hypot(float64(w), float64(h)) + 2*float64(ringGap+border)))
+}
+
+// applyCircularLayout centers the square code in a circle of bg with a border ring of
+// borderColor, leaving the canvas outside the ring transparent. With fill "modules" the
+// space between the code and the ring is filled with decorative modules that continue the
+// code's module grid, seeded by seed. It returns the canvas and where the code sits on it.
+func applyCircularLayout(img image.Image, bg, fg, borderColor color.Color, fill string, border int, pitch float64, seed int64) (*image.RGBA, image.Rectangle) {
+	codeSize := img.Bounds().Size()
+	side := circularLayoutSide(codeSize.X, codeSize.Y, border)
+	center := float64(side) / 2
+	outer := center
+	inner := outer - float64(border)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			distance := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center)
+			coverage := math.Min(math.Max(outer-distance+0.5, 0), 1)
+			if coverage == 0 {
+				continue
+			}
+			// Anti-alias the outer edge against transparency and the ring against the fill
+			c := bg
+			if border > 0 {
+				c = mixColors(bg, borderColor, math.Min(math.Max(distance-inner+0.5, 0), 1))
+			}
+			r, g, b, a := c.RGBA()
+			canvas.Set(x, y, color.RGBA64{uint16(float64(r) * coverage), uint16(float64(g) * coverage), uint16(float64(b) * coverage), uint16(float64(a) * coverage)})
+		}
+	}
+
+	offset := image.Pt((side-codeSize.X)/2, (side-codeSize.Y)/2)
+	code := image.Rectangle{Min: offset, Max: offset.Add(codeSize)}
+
+	if fill == "modules" && pitch >= 1 {
+		rng := rand.New(rand.NewSource(seed))
+		dark := image.NewUniform(fg)
+		// Keep a module of clearance inside the ring
+		limit := inner - pitch
+
+		// Step outwards from the code's origin so the decoration lines up with its modules
+		first := -int(math.Ceil(float64(offset.X) / pitch))
+		last := int(math.Ceil(float64(side-offset.X) / pitch))
+		for row := first; row < last; row++ {
+			for col := first; col < last; col++ {
+				cell := image.Rect(
+					offset.X+int(math.Round(float64(col)*pitch)), offset.Y+int(math.Round(float64(row)*pitch)),
+					offset.X+int(math.Round(float64(col+1)*pitch)), offset.Y+int(math.Round(float64(row+1)*pitch)),
+				)
+				if cell.Overlaps(code) || !cellInsideCircle(cell, center, limit) {
+					continue
+				}
+				if rng.Intn(2) == 0 {
+					draw.Draw(canvas, cell, dark, image.Point{}, draw.Src)
+				}
+			}
+		}
+	}
+
+	draw.Draw(canvas, code, img, img.Bounds().Min, draw.Over)
+	return canvas, code
+}
+
+// cellInsideCircle reports whether every corner of the cell lies within radius of the center
+func cellInsideCircle(cell image.Rectangle, center, radius float64) bool {
+	for _, p := range []image.Point{cell.Min, {X: cell.Max.X, Y: cell.Min.Y}, {X: cell.Min.X, Y: cell.Max.Y}, cell.Max} {
+		if math.Hypot(float64(p.X)-center, float64(p.Y)-center) > radius {
+			return false
+		}
+	}
+	return true
+}
+
+// scaleRect maps r from an image of size from onto the same image resized to size to
+func scaleRect(r image.Rectangle, from, to image.Point) image.Rectangle {
+	if from == to || from.X == 0 || from.Y == 0 {
+		return r
+	}
+	scale := func(v, a, b int) int { return int(math.Round(float64(v) * float64(b) / float64(a))) }
+	return image.Rect(scale(r.Min.X, from.X, to.X), scale(r.Min.Y, from.Y, to.Y), scale(r.Max.X, from.X, to.X), scale(r.Max.Y, from.Y, to.Y))
+}
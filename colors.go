@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// relativeLuminance returns the WCAG relative luminance of a color in the range 0..1
+func relativeLuminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	channel := func(v uint32) float64 {
+		s := float64(v>>8) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(r) + 0.7152*channel(g) + 0.0722*channel(b)
+}
+
+// mixColors blends from a towards b by ratio t (0 keeps a, 1 yields b)
+func mixColors(a, b color.Color, t float64) color.RGBA {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	mix := func(x, y uint32) uint8 {
+		return uint8((float64(x>>8)*(1-t) + float64(y>>8)*t) + 0.5)
+	}
+	return color.RGBA{R: mix(ar, br), G: mix(ag, bg), B: mix(ab, bb), A: mix(aa, ba)}
+}
+
+// isForeground reports whether a pixel matches the foreground color, ignoring alpha
+func isForeground(c, fg color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	fr, fgr, fb, _ := fg.RGBA()
+	return r == fr && g == fgr && b == fb
+}
+
+// isOpaque reports whether a color has no transparency
+func isOpaque(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	return a == 0xffff
+}
+
+// flattenColor composites c over the opaque color matte, as JPEG encoding does
+func flattenColor(c, matte color.Color) color.RGBA {
+	flat := color.RGBAModel.Convert(matte).(color.RGBA)
+	r, g, b, a := c.RGBA()
+	over := func(src uint32, dst uint8) uint8 {
+		return uint8((src + uint32(dst)*0x101*(0xffff-a)/0xffff) >> 8)
+	}
+	return color.RGBA{R: over(r, flat.R), G: over(g, flat.G), B: over(b, flat.B), A: 0xff}
+}
+
+// contrastRatio returns the WCAG contrast ratio between two colors, from 1 to 21
+func contrastRatio(a, b color.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// hexColor formats a color as a #rrggbb string, dropping alpha
+func hexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+// ensureContrast moves c towards black (or white on dark backgrounds) until it reaches
+// the minimum contrast ratio against bg. It reports whether c had to be adjusted.
+func ensureContrast(c, bg color.Color, minRatio float64) (color.Color, bool) {
+	if contrastRatio(c, bg) >= minRatio {
+		return c, false
+	}
+
+	target := color.Color(color.Black)
+	if relativeLuminance(bg) < 0.5 {
+		target = color.White
+	}
+
+	for t := 0.05; t < 1; t += 0.05 {
+		adjusted := mixColors(c, target, t)
+		if contrastRatio(adjusted, bg) >= minRatio {
+			return adjusted, true
+		}
+	}
+	return target, true
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server-wide settings read from the environment at startup
+type Config struct {
+	LogoFetchConcurrency int           // maximum simultaneous logo downloads
+	LogoFetchWait        time.Duration // how long a request waits for a free download slot
+	LogoProxy            string        // proxy URL for logo, image and font downloads, empty connects directly
+	LogoCABundle         string        // PEM file of extra CAs trusted for HTTPS logo, image and font hosts
+	AllowPrivateFetch    bool          // lets downloads come from internal hosts, for local testing
+
+	MaxBodySize int // server-wide request body cap in bytes, per-route limits sit below it
+
+	ReadTimeout  time.Duration // time allowed to read a whole request, guarding against slow clients
+	WriteTimeout time.Duration // time allowed to write a response
+	IdleTimeout  time.Duration // how long keep-alive connections wait for the next request
+
+	BatchWorkers int // codes rendered at once across all batch requests
+
+	GradientPixelBudget int // most pixels a gradient may shade in one image, 0 disables the guard
+
+	DefaultGradientType  string  // gradient_type used when the client leaves it out, "linear" or "radial"
+	DefaultGradientAngle float64 // gradient_angle used when the client leaves it out
+
+	MaxDataLength int // longest data in bytes accepted before encoding, 0 disables the guard
+
+	AllowedSizes   []int    // permitted values for size, empty allows any size
+	AllowedFormats []string // permitted values for format, empty allows every format
+
+	LogoSizeCaps map[string]float64 // largest logo_size allowed per error level, e.g. "H:25,Q:20"
+
+	StoreBackend string // "memory" or "file"
+	StoreDir     string // directory used by the file backend
+	StoreMaxKeys int    // most keys a store holds, new keys beyond it are refused; 0 disables the guard
+
+	PublicURL       string   // base URL dynamic links redirect through, e.g. https://qr.example.com; empty uses the request's host
+	LinkSchemes     []string // schemes a link target may use, empty allows http and https
+	LinkHosts       []string // hosts a link target may point at, each with its subdomains; empty allows any host
+	LinkCreateLimit int      // links one client IP may create per hour, 0 disables the guard
+
+	CacheBackend string        // "memory", "redis" or "none"
+	CacheEntries int           // responses kept by the memory backend
+	CacheBytes   int           // total size of the responses kept by the memory backend
+	CacheTTL     time.Duration // expiry of entries in the redis backend
+	RedisURL     string        // e.g. redis://localhost:6379/0
+
+	WatermarkText       string   // attribution text added to every code, empty disables it
+	WatermarkPosition   string   // "bottom-right", "bottom-left", "top-right", "top-left"
+	WatermarkOpacity    float64  // 0..1
+	WatermarkExemptKeys []string // X-API-Key values whose requests skip the watermark
+}
+
+// loadConfig reads the configuration from environment variables, falling back to defaults
+func loadConfig() Config {
+	return Config{
+		LogoFetchConcurrency: envInt("LOGO_FETCH_CONCURRENCY", 8),
+		LogoFetchWait:        envDuration("LOGO_FETCH_WAIT", 2*time.Second),
+		LogoProxy:            os.Getenv("LOGO_PROXY"),
+		LogoCABundle:         os.Getenv("LOGO_CA_BUNDLE"),
+		AllowPrivateFetch:    envBool("ALLOW_PRIVATE_FETCH", false),
+
+		MaxBodySize: envInt("MAX_BODY_SIZE", 4*1024*1024),
+
+		ReadTimeout:  envDuration("READ_TIMEOUT", 15*time.Second),
+		WriteTimeout: envDuration("WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:  envDuration("IDLE_TIMEOUT", 60*time.Second),
+
+		BatchWorkers: envInt("BATCH_WORKERS", runtime.NumCPU()),
+
+		GradientPixelBudget: envInt("GRADIENT_PIXEL_BUDGET", 0),
+
+		DefaultGradientType:  envString("DEFAULT_GRADIENT_TYPE", "linear"),
+		DefaultGradientAngle: envFloat("DEFAULT_GRADIENT_ANGLE", 0),
+
+		// The most bytes any QR code holds: version 40 at error level L
+		MaxDataLength: envInt("MAX_DATA_LENGTH", 2953),
+
+		AllowedSizes:   envIntList("ALLOWED_SIZES"),
+		AllowedFormats: envList("ALLOWED_FORMATS"),
+
+		LogoSizeCaps: envFloatMap("LOGO_SIZE_CAPS"),
+
+		StoreBackend: envString("STORE_BACKEND", "memory"),
+		StoreDir:     envString("STORE_DIR", "data"),
+		StoreMaxKeys: envInt("STORE_MAX_KEYS", 100000),
+
+		PublicURL:       os.Getenv("PUBLIC_URL"),
+		LinkSchemes:     envList("LINK_SCHEMES"),
+		LinkHosts:       envList("LINK_HOSTS"),
+		LinkCreateLimit: envInt("LINK_CREATE_LIMIT", 60),
+
+		CacheBackend: envString("CACHE_BACKEND", "memory"),
+		CacheEntries: envInt("CACHE_ENTRIES", 512),
+		CacheBytes:   envInt("CACHE_BYTES", 64*1024*1024),
+		CacheTTL:     envDuration("CACHE_TTL", time.Hour),
+		RedisURL:     envString("REDIS_URL", "redis://localhost:6379/0"),
+
+		WatermarkText:       os.Getenv("WATERMARK_TEXT"),
+		WatermarkPosition:   envString("WATERMARK_POSITION", "bottom-right"),
+		WatermarkOpacity:    envFloat("WATERMARK_OPACITY", 0.6),
+		WatermarkExemptKeys: envList("WATERMARK_EXEMPT_KEYS"),
+	}
+}
+
+// envString returns the value of an environment variable or the fallback when unset
+func envString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envList returns the comma separated values of an environment variable
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envInt returns the integer value of an environment variable or the fallback
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// envIntList returns the comma separated integers of an environment variable, skipping invalid entries
+func envIntList(key string) []int {
+	var values []int
+	for _, value := range envList(key) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("invalid %s entry %q, skipping", key, value)
+			continue
+		}
+		values = append(values, n)
+	}
+	return values
+}
+
+// envFloatMap returns the comma separated key:number pairs of an environment variable, skipping invalid entries
+func envFloatMap(key string) map[string]float64 {
+	values := map[string]float64{}
+	for _, entry := range envList(key) {
+		name, value, ok := strings.Cut(entry, ":")
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil {
+			log.Printf("invalid %s entry %q, skipping", key, entry)
+			continue
+		}
+		values[strings.TrimSpace(name)] = f
+	}
+	return values
+}
+
+// envBool returns the boolean value of an environment variable or the fallback
+func envBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using default %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+// envFloat returns the float value of an environment variable or the fallback
+func envFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("invalid %s %q, using default %g", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
+// envDuration returns the duration value of an environment variable or the fallback
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using default %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// debugDataLength is how many characters of data the X-QR-Options header echoes
+const debugDataLength = 32
+
+// debugOptions returns the resolved options as compact JSON for the X-QR-Options header.
+// Data is truncated, vars are reduced to their length and the query strings of fetched
+// URLs, which often carry access tokens, are dropped. Non-ASCII characters are escaped
+// so the value is a valid header.
+func debugOptions(options QRCodeOptions) string {
+	if utf8.RuneCountInString(options.Data) > debugDataLength {
+		options.Data = string([]rune(options.Data)[:debugDataLength]) + "…"
+	}
+	if options.Vars != "" {
+		options.Vars = fmt.Sprintf("(%d bytes)", len(options.Vars))
+	}
+	value := reflect.ValueOf(&options).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).Tag.Get("fetch") == "url" {
+			value.Field(i).SetString(redactQuery(value.Field(i).String()))
+		}
+	}
+
+	encoded, _ := json.Marshal(options)
+	var b strings.Builder
+	for _, r := range string(encoded) {
+		if r < 0x20 || r > 0x7e {
+			// Runes outside the BMP are written as UTF-16 surrogate pairs, as JSON requires
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04x`, unit)
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// redactQuery drops the query string and fragment of a URL
+func redactQuery(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.RawQuery == "" && u.Fragment == "") {
+		return rawURL
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String() + "?…"
+}
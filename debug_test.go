@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDebugOptionsRedactsFetchedURLs(t *testing.T) {
+	options := testOptions("hello")
+	value := reflect.ValueOf(&options).Elem()
+	var fields []string
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Tag.Get("fetch") == "url" {
+			value.Field(i).SetString("https://cdn.example.com/asset?token=secret#frag")
+			fields = append(fields, strings.Split(field.Tag.Get("json"), ",")[0])
+		}
+	}
+	if len(fields) < 6 {
+		t.Fatalf("only %v are tagged as fetched URLs", fields)
+	}
+
+	header := debugOptions(options)
+	if strings.Contains(header, "secret") || strings.Contains(header, "frag") {
+		t.Fatalf("X-QR-Options leaks a query string: %s", header)
+	}
+	var echoed map[string]any
+	if err := json.Unmarshal([]byte(header), &echoed); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range fields {
+		if echoed[name] != "https://cdn.example.com/asset?…" {
+			t.Errorf("%s echoed as %v", name, echoed[name])
+		}
+	}
+}
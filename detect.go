@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// payloadPrefixes maps the case-insensitive prefixes of structured payloads to their type
+var payloadPrefixes = []struct {
+	prefix, kind string
+}{
+	{"WIFI:", "wifi"},
+	{"BEGIN:VCARD", "vcard"},
+	{"MECARD:", "mecard"},
+	{"BEGIN:VEVENT", "event"},
+	{"BEGIN:VCALENDAR", "event"},
+	{"SMSTO:", "sms"},
+	{"SMS:", "sms"},
+	{"MATMSG:", "email"},
+	{"MAILTO:", "email"},
+	{"TEL:", "phone"},
+	{"GEO:", "geo"},
+}
+
+// emailPattern matches a bare email address
+var emailPattern = regexp.MustCompile(`^[^@\s:/]+@[^@\s/]+\.[A-Za-z]{2,}$`)
+
+// phonePattern matches a bare phone number of 7 to 15 digits with common separators
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ().-]*[0-9]$`)
+
+// detectType names the kind of content in data: wifi, vcard, mecard, event, sms, email,
+// phone, geo, crypto, url or text. bare is set for an email address or phone number
+// written without the mailto: or tel: scheme that makes scanners act on it.
+func detectType(data string) (kind string, bare bool) {
+	trimmed := strings.TrimSpace(data)
+	upper := strings.ToUpper(trimmed)
+	for _, p := range payloadPrefixes {
+		if strings.HasPrefix(upper, p.prefix) {
+			return p.kind, false
+		}
+	}
+
+	if u, err := url.Parse(trimmed); err == nil {
+		if currency, ok := cryptoCurrencies[strings.ToLower(u.Scheme)]; ok && currency.address.MatchString(u.Opaque) {
+			return "crypto", false
+		}
+	}
+	if isWebURL(trimmed) {
+		return "url", false
+	}
+	if emailPattern.MatchString(trimmed) {
+		return "email", true
+	}
+	if n := countDigits(trimmed); phonePattern.MatchString(trimmed) && n >= 7 && n <= 15 {
+		return "phone", true
+	}
+	return "text", false
+}
+
+// countDigits returns the number of ASCII digits in s
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// isStructuredPayload reports whether data is already a complete payload of its type,
+// which a type would otherwise wrap a second time
+func isStructuredPayload(data string) bool {
+	kind, bare := detectType(data)
+	return kind != "text" && kind != "url" && !bare
+}
+
+// typeWarnings checks data against the conventions of its detected type
+func typeWarnings(data string) []string {
+	kind, bare := detectType(data)
+	upper := strings.ToUpper(strings.TrimSpace(data))
+	switch {
+	case bare && kind == "email":
+		return []string{"data looks like an email address; prefix it with mailto: so scanners offer to write an email"}
+	case bare && kind == "phone":
+		return []string{"data looks like a phone number; prefix it with tel: so scanners offer to call it"}
+	case kind == "wifi" && (!strings.Contains(upper, "S:") || !strings.HasSuffix(upper, ";;")):
+		return []string{"data looks like a WIFI: payload but lacks an S: network name or the closing ;;"}
+	case kind == "vcard" && !strings.Contains(upper, "END:VCARD"):
+		return []string{"data looks like a vCard but has no END:VCARD line"}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+// printFormats holds the formats whose size maps to printed pixels, so dpi applies to them
+var printFormats = map[string]bool{"png": true, "jpeg": true, "gocode": true, "svg": true}
+
+// modulePixels returns the average width in pixels of one module once the code is rendered
+func modulePixels(qr *qrcode.QRCode, options QRCodeOptions) float64 {
+	if sides, asymmetric := resolveSideBorders(options); asymmetric {
+		return float64(sides.symbolSize(qr, options.Size)) / float64(len(qr.Bitmap()))
+	}
+	_, size := borderPixels(qr, options)
+	return float64(size) / float64(len(qr.Bitmap())+2*options.Border)
+}
+
+// moduleMillimeters converts a module width in pixels to millimeters printed at dpi
+func moduleMillimeters(pixels float64, dpi int) float64 {
+	return pixels / float64(dpi) * 25.4
+}
+
+// checkPrintSize rejects codes whose modules print narrower than min_module_mm at the
+// requested dpi, and records the module width for the response headers
+func checkPrintSize(qr *qrcode.QRCode, options *QRCodeOptions) error {
+	options.modulePixels = modulePixels(qr, *options)
+	mm := moduleMillimeters(options.modulePixels, options.DPI)
+	if mm >= options.MinModuleMM {
+		return nil
+	}
+	// The module width grows in step with size
+	need := int(math.Ceil(float64(max(options.Size, 1)) * options.MinModuleMM / mm))
+	return fiber.NewError(400, fmt.Sprintf("modules print %.2fmm wide at %d dpi, below min_module_mm of %g; raise size to at least %d or lower dpi",
+		mm, options.DPI, options.MinModuleMM, need))
+}
+
+// pngHeaderEnd is the offset just past the signature and IHDR chunk every PNG starts with
+const pngHeaderEnd = 8 + 4 + 4 + 13 + 4
+
+// withPNGResolution returns the PNG with a pHYs chunk recording dpi as pixels per meter,
+// inserted directly after the IHDR chunk, so print software places it at its physical size
+func withPNGResolution(pngData []byte, dpi int) ([]byte, error) {
+	if len(pngData) < pngHeaderEnd || !bytes.HasPrefix(pngData, []byte("\x89PNG\r\n\x1a\n")) || string(pngData[12:16]) != "IHDR" {
+		return nil, errors.New("not a PNG stream")
+	}
+
+	ppm := uint32(math.Round(float64(dpi) / 0.0254))
+	var chunk bytes.Buffer
+	chunk.WriteString("pHYs")
+	binary.Write(&chunk, binary.BigEndian, ppm) // horizontal
+	binary.Write(&chunk, binary.BigEndian, ppm) // vertical
+	chunk.WriteByte(1)                          // unit: meter
+
+	var out bytes.Buffer
+	out.Write(pngData[:pngHeaderEnd])
+	binary.Write(&out, binary.BigEndian, uint32(chunk.Len()-4))
+	out.Write(chunk.Bytes())
+	binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(chunk.Bytes()))
+	out.Write(pngData[pngHeaderEnd:])
+	return out.Bytes(), nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Module roles in a symbol, as classified by codewordRoles
+const (
+	roleFunction  = iota // finder, timing, alignment, format and version patterns
+	roleData             // data codewords, padding included
+	roleEC               // error correction codewords
+	roleRemainder        // leftover bits after the last codeword
+)
+
+// alignmentPositions returns the row and column centers of the alignment patterns of a version
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + count*2 + 1) / (count*2 - 2) * 2
+	}
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, 4*version+10; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// functionModules marks the modules of a symbol that hold function patterns rather than codewords
+func functionModules(version int) [][]bool {
+	n := 4*version + 17
+	function := make([][]bool, n)
+	for y := range function {
+		function[y] = make([]bool, n)
+	}
+	mark := func(x0, y0, w, h int) {
+		for y := max(0, y0); y < min(n, y0+h); y++ {
+			for x := max(0, x0); x < min(n, x0+w); x++ {
+				function[y][x] = true
+			}
+		}
+	}
+
+	// Finder patterns with separators, and the format information beside them
+	mark(0, 0, 9, 9)
+	mark(n-8, 0, 8, 9)
+	mark(0, n-8, 9, 8)
+
+	// Timing patterns
+	mark(0, 6, n, 1)
+	mark(6, 0, 1, n)
+
+	// Alignment patterns, except where they would overlap the finders
+	positions := alignmentPositions(version)
+	for i, cy := range positions {
+		for j, cx := range positions {
+			last := len(positions) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			mark(cx-2, cy-2, 5, 5)
+		}
+	}
+
+	// Version information blocks
+	if version >= 7 {
+		mark(n-11, 0, 3, 6)
+		mark(0, n-11, 6, 3)
+	}
+	return function
+}
+
+// codewordRoles classifies every module of the symbol by walking the codeword placement
+// zigzag: the interleaved data codewords come first, then the error correction codewords
+func codewordRoles(qr *qrcode.QRCode, level qrcode.RecoveryLevel) [][]int {
+	data, total := dataCodewords[level][qr.VersionNumber-1], totalCodewords(qr.VersionNumber)
+	roles := codewordIndexes(qr.VersionNumber)
+	for _, row := range roles {
+		for x, codeword := range row {
+			switch {
+			case codeword < 0:
+				row[x] = roleFunction
+			case codeword < data:
+				row[x] = roleData
+			case codeword < total:
+				row[x] = roleEC
+			default:
+				row[x] = roleRemainder
+			}
+		}
+	}
+	return roles
+}
+
+// codewordIndexes returns the interleaved codeword each module of a symbol holds a bit of,
+// or -1 for function pattern modules. Remainder bits get indexes past the last codeword.
+func codewordIndexes(version int) [][]int {
+	n := 4*version + 17
+	function := functionModules(version)
+
+	// The walk skips the vertical timing column, so every module starts as a function module
+	indexes := make([][]int, n)
+	for y := range indexes {
+		indexes[y] = slices.Repeat([]int{-1}, n)
+	}
+
+	bit := 0
+	for right := n - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern shifts the columns left of it by one
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < n; vert++ {
+			y := vert
+			if upward {
+				y = n - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if function[y][x] {
+					continue
+				}
+				indexes[y][x] = bit / 8
+				bit++
+			}
+		}
+	}
+	return indexes
+}
+
+// ecOverlayColors tints each module role; function patterns and the remainder stay untinted
+var ecOverlayColors = map[int]color.RGBA{
+	roleData: {R: 0, G: 110, B: 255, A: 255},
+	roleEC:   {R: 255, G: 130, B: 0, A: 255},
+}
+
+// ecOverlayStrength is how far the tint is mixed into the modules
+const ecOverlayStrength = 0.4
+
+// applyECOverlay highlights data codeword modules in blue and error correction modules in
+// orange over the image, which spans the symbol plus a quiet zone of quietZone modules
+func applyECOverlay(img image.Image, qr *qrcode.QRCode, level qrcode.RecoveryLevel, quietZone int) *image.RGBA {
+	roles := codewordRoles(qr, level)
+	modules := len(roles) + 2*quietZone
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+
+	size := bounds.Dx()
+	for y := 0; y < bounds.Dy(); y++ {
+		my := y*modules/size - quietZone
+		if my < 0 || my >= len(roles) {
+			continue
+		}
+		for x := 0; x < size; x++ {
+			mx := x*modules/size - quietZone
+			if mx < 0 || mx >= len(roles) {
+				continue
+			}
+			if tint, ok := ecOverlayColors[roles[my][mx]]; ok {
+				result.Set(x, y, mixColors(result.At(x, y), tint, ecOverlayStrength))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// exifOrientationTag is the EXIF tag holding the display orientation, 1 (upright) to 8
+const exifOrientationTag = 0x0112
+
+// withJPEGOrientation returns the JPEG with an APP1 EXIF segment holding only the
+// orientation tag, inserted directly after the start-of-image marker
+func withJPEGOrientation(jpegData []byte, orientation int) ([]byte, error) {
+	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
+		return nil, errors.New("not a JPEG stream")
+	}
+
+	// Big-endian TIFF header followed by a single-entry IFD0
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8)) // IFD0 offset
+	binary.Write(&tiff, binary.BigEndian, uint16(1)) // entry count
+	binary.Write(&tiff, binary.BigEndian, uint16(exifOrientationTag))
+	binary.Write(&tiff, binary.BigEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.BigEndian, uint32(1)) // value count
+	binary.Write(&tiff, binary.BigEndian, uint16(orientation))
+	binary.Write(&tiff, binary.BigEndian, uint16(0)) // pad the value to 4 bytes
+	binary.Write(&tiff, binary.BigEndian, uint32(0)) // no next IFD
+
+	var out bytes.Buffer
+	out.Write(jpegData[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(2+6+tiff.Len()))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(jpegData[2:])
+	return out.Bytes(), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// modulePixelRange returns the pixel span [start, end) covered by module m when a
+// symbol of the given module count is scaled to size pixels, matching go-qrcode's
+// nearest-module mapping
+func modulePixelRange(m, modules, size int) (start, end int) {
+	start = (m*size + modules - 1) / modules
+	end = ((m+1)*size + modules - 1) / modules
+	return start, end
+}
+
+// moduleRect returns the pixel rectangle covering a w x h block of modules starting at (mx, my)
+func moduleRect(mx, my, w, h, modules, size int) image.Rectangle {
+	x0, _ := modulePixelRange(mx, modules, size)
+	_, x1 := modulePixelRange(mx+w-1, modules, size)
+	y0, _ := modulePixelRange(my, modules, size)
+	_, y1 := modulePixelRange(my+h-1, modules, size)
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// eyeCenters returns the top-left module of the 3x3 center of each finder pattern
+func eyeCenters(modules, quietZone int) []image.Point {
+	symbol := modules - 2*quietZone
+	near, far := quietZone+2, quietZone+symbol-5
+	return []image.Point{{X: near, Y: near}, {X: far, Y: near}, {X: near, Y: far}}
+}
+
+// meanLuminance returns the alpha weighted average luminance of an image over white
+func meanLuminance(img image.Image) float64 {
+	bounds := img.Bounds()
+	total := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// Composite the premultiplied pixel over white
+			over := func(v uint32) uint8 { return uint8((v + (0xffff - a)) >> 8) }
+			total += relativeLuminance(color.RGBA{R: over(r), G: over(g), B: over(b), A: 255})
+		}
+	}
+	return total / float64(bounds.Dx()*bounds.Dy())
+}
+
+// applyEyeImages replaces the 3x3 center of each finder pattern with the eye image,
+// fitted inside the center so the surrounding ring and separator stay intact
+func applyEyeImages(img image.Image, eye image.Image, modules, quietZone int, bg color.Color) *image.RGBA {
+	result := image.NewRGBA(img.Bounds())
+	draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Src)
+	size := img.Bounds().Dx()
+
+	for _, center := range eyeCenters(modules, quietZone) {
+		rect := moduleRect(center.X, center.Y, 3, 3, modules, size)
+		fitted := fitLogo(eye, rect.Dx(), rect.Dy())
+		fittedSize := fitted.Bounds().Size()
+		offset := rect.Min.Add(image.Pt((rect.Dx()-fittedSize.X)/2, (rect.Dy()-fittedSize.Y)/2))
+
+		draw.Draw(result, rect, image.NewUniform(bg), image.Point{}, draw.Src)
+		draw.Draw(result, image.Rectangle{Min: offset, Max: offset.Add(fittedSize)}, fitted, image.Point{}, draw.Over)
+	}
+
+	return result
+}
+
+// eyeStyle shapes and colors the two parts of each finder pattern. A nil color keeps
+// the color already drawn there.
+type eyeStyle struct {
+	outer, inner           string // "square", "rounded" or "circle"
+	outerColor, innerColor color.Color
+}
+
+// eyeShapeMask builds the alpha mask of a w x h finder part in the given shape
+func eyeShapeMask(shape string, w, h int) *image.Alpha {
+	switch shape {
+	case "circle":
+		return circleMask(w, h)
+	case "rounded":
+		return roundedRectMask(w, h, min(w, h)/4)
+	default:
+		return roundedRectMask(w, h, 0)
+	}
+}
+
+// applyEyeShapes redraws each finder pattern as a 7x7 outer ring with a one module wide
+// hole and a 3x3 inner dot, each in its own shape and color. Pixels the shapes leave
+// uncovered take the background color.
+func applyEyeShapes(img image.Image, modules, quietZone int, style eyeStyle, bg color.Color) *image.RGBA {
+	result := image.NewRGBA(img.Bounds())
+	draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Src)
+	size := img.Bounds().Dx()
+	background := image.NewUniform(bg)
+
+	for _, center := range eyeCenters(modules, quietZone) {
+		outer := moduleRect(center.X-2, center.Y-2, 7, 7, modules, size)
+		hole := moduleRect(center.X-1, center.Y-1, 5, 5, modules, size)
+		inner := moduleRect(center.X, center.Y, 3, 3, modules, size)
+
+		outerColor, innerColor := style.outerColor, style.innerColor
+		if outerColor == nil {
+			outerColor = result.At(outer.Min.X, outer.Min.Y)
+		}
+		if innerColor == nil {
+			innerColor = result.At((inner.Min.X+inner.Max.X)/2, (inner.Min.Y+inner.Max.Y)/2)
+		}
+
+		draw.Draw(result, outer, background, image.Point{}, draw.Src)
+		draw.DrawMask(result, outer, image.NewUniform(outerColor), image.Point{}, eyeShapeMask(style.outer, outer.Dx(), outer.Dy()), image.Point{}, draw.Over)
+		draw.DrawMask(result, hole, background, image.Point{}, eyeShapeMask(style.outer, hole.Dx(), hole.Dy()), image.Point{}, draw.Over)
+		draw.DrawMask(result, inner, image.NewUniform(innerColor), image.Point{}, eyeShapeMask(style.inner, inner.Dx(), inner.Dy()), image.Point{}, draw.Over)
+	}
+
+	return result
+}
+
+// eyeShapes returns the finder pattern style the options ask for, and whether it differs
+// from the plain square finders
+func eyeShapes(options QRCodeOptions) (eyeStyle, bool) {
+	style := eyeStyle{outer: options.EyeOuterShape, inner: options.EyeInnerShape}
+	if options.EyeOuterColor != "" {
+		style.outerColor = parseColor(options.EyeOuterColor)
+	}
+	if options.EyeInnerColor != "" {
+		style.innerColor = parseColor(options.EyeInnerColor)
+	}
+	plain := style.outer == "square" && style.inner == "square" && style.outerColor == nil && style.innerColor == nil
+	return style, !plain
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestEyeShapesDecode(t *testing.T) {
+	for _, outer := range optionRules["eye_outer_shape"].enum {
+		for _, inner := range optionRules["eye_inner_shape"].enum {
+			options := testOptions("https://example.com/eyes")
+			options.EyeOuterShape, options.EyeInnerShape = outer, inner
+			options.EyeOuterColor, options.EyeInnerColor = "rgb(0,60,120)", "rgb(140,0,0)"
+			img := renderCode(t, options)
+			if got, err := decodeImage(img); err != nil || string(got) != options.Data {
+				t.Errorf("outer %s, inner %s: decoded %q, %v", outer, inner, got, err)
+			}
+		}
+	}
+}
+
+func TestSquareEyesAreOpaque(t *testing.T) {
+	options := testOptions("https://example.com/eyes")
+	options.EyeOuterColor = "rgb(0,60,120)"
+	img := renderCode(t, options)
+
+	// The top-left corner of the first finder pattern takes the outer color exactly
+	qr, err := newQRCode(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := len(moduleMatrix(qr, options.Border))
+	corner := moduleRect(options.Border, options.Border, 1, 1, modules, img.Bounds().Dx())
+	want := color.RGBA{R: 0, G: 60, B: 120, A: 255}
+	if got := color.RGBAModel.Convert(img.At(corner.Min.X, corner.Min.Y)); got != want {
+		t.Errorf("outer ring corner is %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+// errPrivateHost is returned when a public-only fetch would connect to an internal address
+var errPrivateHost = errors.New("host resolves to a non-public address")
+
+// carrierGradeNAT is the shared address space of RFC 6598, which IsPrivate does not cover
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsMulticast() &&
+		!carrierGradeNAT.Contains(ip)
+}
+
+// publicClient downloads every URL given in the options. It checks every address it dials
+// after DNS resolution, so redirects and DNS rebinding cannot reach internal hosts.
+// ALLOW_PRIVATE_FETCH lifts the check for local testing; initPublicClient configures it.
+var publicClient = newPublicClient(false, nil, nil)
+
+// initPublicClient builds publicClient from the configuration. Downloads go through the
+// proxy when one is set, and certificates from the CA bundle file are trusted in addition
+// to the system roots.
+func initPublicClient(allowPrivate bool, proxyURL, caBundle string) error {
+	var proxy *url.URL
+	if proxyURL != "" {
+		var err error
+		if proxy, err = url.Parse(proxyURL); err != nil {
+			return fmt.Errorf("invalid LOGO_PROXY: %w", err)
+		}
+	}
+
+	var roots *x509.CertPool
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return fmt.Errorf("reading LOGO_CA_BUNDLE: %w", err)
+		}
+		if roots, err = x509.SystemCertPool(); err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("LOGO_CA_BUNDLE %s holds no PEM certificates", caBundle)
+		}
+	}
+
+	publicClient = newPublicClient(allowPrivate, proxy, roots)
+	return nil
+}
+
+// newPublicClient builds a client refusing non-public addresses unless allowPrivate is set.
+// Without a proxy it connects directly and checks each address it dials. A proxy, which
+// may itself be internal, connects on the client's behalf, so the target host is resolved
+// and checked before each request instead; the proxy resolves it again, so the operator
+// is trusted to run one that does not serve internal hosts to a rebinding DNS answer.
+func newPublicClient(allowPrivate bool, proxy *url.URL, roots *x509.CertPool) *http.Client {
+	direct := &net.Dialer{Timeout: 10 * time.Second}
+	checked := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !allowPrivate && !isPublicIP(net.ParseIP(host)) {
+				return errPrivateHost
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	var proxyAddress string
+	if proxy != nil {
+		proxyAddress = proxyHostPort(proxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if !allowPrivate {
+				if err := checkPublicHost(req.Context(), req.URL.Hostname()); err != nil {
+					return nil, err
+				}
+			}
+			return proxy, nil
+		}
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == proxyAddress {
+			return direct.DialContext(ctx, network, address)
+		}
+		return checked.DialContext(ctx, network, address)
+	}
+	if roots != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	return &http.Client{Transport: transport, Timeout: logoFetchTimeout}
+}
+
+// proxyHostPort returns the address the transport dials for the proxy, with the default
+// port of its scheme when it names none
+func proxyHostPort(proxy *url.URL) string {
+	if port := proxy.Port(); port != "" {
+		return net.JoinHostPort(proxy.Hostname(), port)
+	}
+	port := map[string]string{"https": "443", "socks5": "1080", "socks5h": "1080"}[proxy.Scheme]
+	if port == "" {
+		port = "80"
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// checkPublicHost resolves host and returns errPrivateHost unless every address is public
+func checkPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return errPrivateHost
+		}
+	}
+	return nil
+}
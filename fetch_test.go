@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestFetchedURLsMustBePublic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("internal host reached for %s", r.URL)
+	}))
+	defer server.Close()
+
+	fields := map[string]func(*QRCodeOptions, string){
+		"logo_url":             func(o *QRCodeOptions, u string) { o.LogoURL = u },
+		"logo_mask_url":        func(o *QRCodeOptions, u string) { o.LogoMaskURL = u },
+		"eye_image_url":        func(o *QRCodeOptions, u string) { o.EyeImageURL = u },
+		"background_image_url": func(o *QRCodeOptions, u string) { o.BackgroundImageURL = u },
+		"module_image_url":     func(o *QRCodeOptions, u string) { o.ModuleImageURL = u },
+	}
+	for _, format := range []string{"png", "svg"} {
+		for name, set := range fields {
+			if format == "svg" && name != "logo_url" {
+				continue
+			}
+			options := testOptions("https://example.com")
+			options.Error = "H"
+			options.Format = format
+			set(&options, server.URL+"/image.png")
+			if _, err := prepareOptions(&options); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			_, _, err := renderOutput(options, nil)
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) || fiberErr.Code != 400 {
+				t.Errorf("%s %s from a loopback host: %v, want a 400", format, name, err)
+			}
+		}
+	}
+}
+
+func TestPublicClientThroughProxy(t *testing.T) {
+	logo := serveImage(t, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	// A forward proxy on loopback, which is allowed although the targets it serves are checked
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Get(logo)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := newPublicClient(false, proxyURL, nil)
+
+	// A public target goes through the proxy without DNS, being an address already
+	if _, err := fetchImage(client, "http://93.184.216.34/logo.png"); err != nil {
+		t.Errorf("public target through the proxy: %v", err)
+	}
+	for _, target := range []string{"http://127.0.0.1/logo.png", "http://10.0.0.1/logo.png", "http://[::1]/logo.png"} {
+		if _, err := fetchImage(client, target); !errors.Is(err, errPrivateHost) {
+			t.Errorf("%s through the proxy: %v, want errPrivateHost", target, err)
+		}
+	}
+}
+
+func TestFetchedImagesAreBounded(t *testing.T) {
+	// A single row compresses to a few kilobytes but decodes to more than maxFetchedPixels
+	huge := serveImage(t, image.NewGray(image.Rect(0, 0, maxFetchedPixels+1, 1)))
+	for _, format := range []string{"png", "svg"} {
+		options := testOptions("https://example.com")
+		options.Error = "H"
+		options.Format = format
+		options.LogoURL = huge
+		if _, err := prepareOptions(&options); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := renderOutput(options, nil)
+		var fiberErr *fiber.Error
+		if !errors.As(err, &fiberErr) || fiberErr.Code != 400 || !strings.Contains(fiberErr.Message, "pixels") {
+			t.Errorf("%s logo with %d pixels: %v, want a 400", format, maxFetchedPixels+1, err)
+		}
+	}
+}
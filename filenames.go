@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxFilePatternLength bounds the length of a batch filename pattern
+const maxFilePatternLength = 128
+
+// filePlaceholders matches the placeholders a batch filename pattern may use
+var filePlaceholders = regexp.MustCompile(`\{(index|hash)\}`)
+
+// safeFilename matches what is left of a pattern once its placeholders are removed:
+// letters, digits, dots, dashes and underscores, so names cannot leave their directory
+var safeFilename = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+
+// validateFilePattern checks a batch filename pattern. It must name a PNG and contain
+// {index} or {hash}, so every item gets its own stable name.
+func validateFilePattern(pattern string) error {
+	literal := filePlaceholders.ReplaceAllString(pattern, "")
+	switch {
+	case len(pattern) > maxFilePatternLength:
+		return fiber.NewError(400, fmt.Sprintf("files must be at most %d characters", maxFilePatternLength))
+	case !filePlaceholders.MatchString(pattern):
+		return fiber.NewError(400, "files must contain {index} or {hash}")
+	case !safeFilename.MatchString(literal) || strings.Contains(literal, ".."):
+		return fiber.NewError(400, "files may only contain letters, digits, '.', '-', '_' and the {index} and {hash} placeholders")
+	case strings.HasPrefix(pattern, "."):
+		return fiber.NewError(400, "files must not start with '.'")
+	case !strings.HasSuffix(pattern, ".png"):
+		return fiber.NewError(400, "files must end in .png")
+	}
+	return nil
+}
+
+// itemHash returns a short hash of everything that shapes an item's image, so the same
+// item always gets the same name however the batch around it changes
+func itemHash(options QRCodeOptions) string {
+	normalized, _ := json.Marshal(struct {
+		QRCodeOptions
+		Version int `json:"version"`
+	}{options, options.version})
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:6])
+}
+
+// itemFilename expands the pattern for item index of count. Indexes are zero padded to
+// the width of the last one, so names sort in batch order.
+func itemFilename(pattern string, index, count int, options QRCodeOptions) string {
+	width := len(strconv.Itoa(count - 1))
+	return filePlaceholders.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		if placeholder == "{index}" {
+			return fmt.Sprintf("%0*d", width, index)
+		}
+		return itemHash(options)
+	})
+}
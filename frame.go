@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// applyFrame draws a dotted or dashed frame around the code, running along the middle of
+// the quiet zone with a stroke at most a quarter of its width so modules are never touched.
+// dash sets the dash length and dot spacing in pixels. It reports false and leaves img
+// unchanged when the quiet zone is too thin to hold a frame.
+func applyFrame(img, mask image.Image, fg color.Color, style string, frameColor color.Color, dash int) (image.Image, bool) {
+	bounds := img.Bounds()
+	modules := moduleBounds(mask, fg)
+	margin := min(modules.Min.X-bounds.Min.X, modules.Min.Y-bounds.Min.Y, bounds.Max.X-modules.Max.X, bounds.Max.Y-modules.Max.Y)
+	if margin < 4 {
+		return img, false
+	}
+
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+
+	thickness := max(1, margin/4)
+	path := modules.Inset(-margin / 2)
+	paint := image.NewUniform(frameColor)
+
+	// Walk the perimeter clockwise one pixel at a time, stamping dashes or dots
+	step := 0
+	stamp := func(x, y int) {
+		defer func() { step++ }()
+		half := thickness / 2
+		switch style {
+		case "dashed":
+			if step%(2*dash) < dash {
+				draw.Draw(result, image.Rect(x-half, y-half, x-half+thickness, y-half+thickness), paint, image.Point{}, draw.Over)
+			}
+		case "dotted":
+			if step%dash == 0 {
+				r := max(1, (thickness+1)/2)
+				for dy := -r; dy <= r; dy++ {
+					for dx := -r; dx <= r; dx++ {
+						if dx*dx+dy*dy <= r*r {
+							result.Set(x+dx, y+dy, frameColor)
+						}
+					}
+				}
+			}
+		}
+	}
+	for x := path.Min.X; x < path.Max.X; x++ {
+		stamp(x, path.Min.Y)
+	}
+	for y := path.Min.Y; y < path.Max.Y; y++ {
+		stamp(path.Max.X, y)
+	}
+	for x := path.Max.X; x > path.Min.X; x-- {
+		stamp(x, path.Max.Y)
+	}
+	for y := path.Max.Y; y > path.Min.Y; y-- {
+		stamp(path.Min.X, y)
+	}
+
+	return result, true
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+// newQRCode encodes the data and applies the color and border options
+func newQRCode(options QRCodeOptions) (*qrcode.QRCode, error) {
+	// Generate base QR code
+	level := getErrorCorrection(options.Error)
+	var qr *qrcode.QRCode
+	var err error
+	if options.version > 0 {
+		qr, err = qrcode.NewWithForcedVersion(options.Data, options.version, level)
+	} else {
+		qr, err = qrcode.New(options.Data, level)
+	}
+	if err != nil {
+		// Non-ASCII text is encoded in byte mode, so capacity counts UTF-8 bytes rather than characters
+		if limit := maxDataLength(level, "byte", 40); len(options.Data) > limit {
+			return nil, fiber.NewError(400, fmt.Sprintf("data is %d bytes (%d characters); at most %d bytes fit at error level %s",
+				len(options.Data), utf8.RuneCountInString(options.Data), limit, options.Error))
+		}
+		return nil, fiber.NewError(500, "Failed to generate QR code")
+	}
+
+	// Set QR code properties
+	qr.ForegroundColor = parseColor(options.Foreground)
+	qr.BackgroundColor = parseColor(options.Background)
+
+	// The quiet zone is drawn by moduleMatrix, so it can be any width
+	qr.DisableBorder = true
+
+	return qr, nil
+}
+
+// moduleMatrix returns the symbol's modules surrounded by a quiet zone of border light modules
+func moduleMatrix(qr *qrcode.QRCode, border int) [][]bool {
+	symbol := qr.Bitmap()
+	modules := len(symbol) + 2*border
+
+	bitmap := make([][]bool, modules)
+	for y := range bitmap {
+		bitmap[y] = make([]bool, modules)
+		if y >= border && y < border+len(symbol) {
+			copy(bitmap[y][border:], symbol[y-border])
+		}
+	}
+	return bitmap
+}
+
+// renderMatrix draws the module matrix at the given size, mapping each pixel to the
+// nearest module. Sizes below one pixel per module are raised to the module count.
+func renderMatrix(bitmap [][]bool, size int, fg, bg color.Color) *image.RGBA {
+	modules := len(bitmap)
+	size = max(size, modules)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	fgPixel, bgPixel := image.NewUniform(fg), image.NewUniform(bg)
+	for y := 0; y < size; y++ {
+		row := bitmap[y*modules/size]
+		for x := 0; x < size; x++ {
+			c := bgPixel
+			if row[x*modules/size] {
+				c = fgPixel
+			}
+			img.Set(x, y, c.C)
+		}
+	}
+	return img
+}
+
+// maxBorderPercent is the largest share of the image width the quiet zone may take up
+const maxBorderPercent = 40
+
+// borderPixels returns the total quiet zone width (both sides) and the image size
+// generateImage renders. The image is options.Size wide, or one pixel per module if
+// that is larger, and the quiet zone takes options.Border modules on each side.
+func borderPixels(qr *qrcode.QRCode, options QRCodeOptions) (border, size int) {
+	modules := len(qr.Bitmap()) + 2*options.Border
+	size = max(options.Size, modules)
+	return 2 * options.Border * size / modules, size
+}
+
+// validateBorder rejects borders that leave too little of the image for the modules
+func validateBorder(qr *qrcode.QRCode, options QRCodeOptions) error {
+	border, size := borderPixels(qr, options)
+	if border*100 >= size*maxBorderPercent {
+		return fiber.NewError(400, fmt.Sprintf("border takes %d of %d pixels; it must stay below %d%% of the image size", border, size, maxBorderPercent))
+	}
+	return nil
+}
+
+// gradientColors parses the gradient stops, darkening them against the background
+// when gradient_autocontrast is set and returning a warning for every adjusted stop
+func gradientColors(options QRCodeOptions, bg color.Color) (start, end color.Color, warnings []string) {
+	start = parseColor(options.GradientStart)
+	end = parseColor(options.GradientEnd)
+
+	// Keep both ends of the gradient readable against the background
+	if options.GradientAutoContrast {
+		var adjusted bool
+		if start, adjusted = ensureContrast(start, bg, minModuleContrast); adjusted {
+			warnings = append(warnings, "gradient_start adjusted to "+hexColor(start)+" for contrast")
+		}
+		if end, adjusted = ensureContrast(end, bg, minModuleContrast); adjusted {
+			warnings = append(warnings, "gradient_end adjusted to "+hexColor(end)+" for contrast")
+		}
+	}
+	return start, end, warnings
+}
+
+// generateImage renders the QR code with all requested decorations applied.
+// Warnings about adjustments made while rendering are returned alongside the image,
+// and facts reported back as headers are recorded in report.
+func generateImage(options QRCodeOptions, timer *stageTimer, report *renderReport) (image.Image, []string, error) {
+	var warnings []string
+
+	qr, err := newQRCode(options)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	// Per-side borders render the bare symbol and add each side's margin after the logo
+	sides, asymmetric := resolveSideBorders(options)
+	if asymmetric {
+		if err := sides.validate(qr); err != nil {
+			return nil, warnings, err
+		}
+		options.Size = sides.symbolSize(qr, options.Size)
+		options.Border = 0
+	} else if err := validateBorder(qr, options); err != nil {
+		return nil, warnings, err
+	}
+
+	// Draw the modules with a quiet zone of exactly options.Border modules
+	bitmap := moduleMatrix(qr, options.Border)
+
+	// Clear the modules under the logo mask, leaving the logo as negative space
+	if options.LogoMaskURL != "" {
+		mask, err := fetchLogo(options.LogoMaskURL)
+		if err != nil {
+			return nil, warnings, fetchFailure(err, "logo_mask_url", "Failed to fetch logo mask")
+		}
+		if err := applyLogoMask(bitmap, qr, mask, options.LogoMaskSize, options.Error, options.Border); err != nil {
+			return nil, warnings, err
+		}
+		timer.mark("logo_mask")
+	}
+	var img image.Image
+	if options.ModuleJitter > 0 || options.ModuleGap > 0 {
+		style := moduleStyle{jitter: options.ModuleJitter, gap: options.ModuleGap / 100, samples: moduleSamples[options.ModuleQuality], seed: options.Seed}
+		img = renderJitteredMatrix(bitmap, options.Size, qr.ForegroundColor, qr.BackgroundColor, options.Border, style)
+	} else {
+		img = renderMatrix(bitmap, options.Size, qr.ForegroundColor, qr.BackgroundColor)
+	}
+
+	// Keep the plain render as a module mask for later compositing steps
+	base := img
+	timer.mark("encode")
+
+	// Vary module colors from the palette if specified
+	if options.Palette != "" {
+		palette, paletteWarnings, err := parsePalette(options.Palette, qr.BackgroundColor)
+		warnings = append(warnings, paletteWarnings...)
+		if err != nil {
+			return nil, warnings, err
+		}
+		img = applyPalette(img, bitmap, options.Border, qr.ForegroundColor, palette, options.Seed)
+		timer.mark("palette")
+	}
+
+	// Two-tone the modules on either side of the split line
+	if options.SplitColors != "" {
+		first, second, _ := parseSplitColors(options.SplitColors)
+		img = applySplitColors(img, bitmap, options.Border, qr.ForegroundColor, first, second, options.SplitAngle)
+		timer.mark("split")
+	}
+
+	// The color behind the center of the code, which logo_blend tints the logo towards
+	var centerColor color.Color = qr.BackgroundColor
+
+	// Apply gradient if specified
+	if options.GradientStart != "" && options.GradientEnd != "" {
+		// The gradient shades every pixel, so refuse sizes past the budget before starting
+		if cost := img.Bounds().Dx() * img.Bounds().Dy(); config.GradientPixelBudget > 0 && cost > config.GradientPixelBudget {
+			return nil, warnings, fiber.NewError(400, fmt.Sprintf("gradient would shade %d pixels, above the budget of %d; lower size", cost, config.GradientPixelBudget))
+		}
+		startColor, endColor, adjusted := gradientColors(options, qr.BackgroundColor)
+		warnings = append(warnings, adjusted...)
+		gradient := createGradient(img.Bounds().Dx(), img.Bounds().Dy(), startColor, endColor, options.GradientType, gradientDirection(options))
+		centerColor = gradient.At(img.Bounds().Dx()/2, img.Bounds().Dy()/2)
+
+		// Create a new RGBA image for the result
+		finalImg := image.NewRGBA(img.Bounds())
+
+		// Draw the gradient first
+		draw.Draw(finalImg, finalImg.Bounds(), gradient, image.Point{}, draw.Src)
+
+		// Draw the QR code on top, but only where it's the foreground color
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				// Check if the pixel matches the foreground color
+				if isForeground(img.At(x, y), qr.ForegroundColor) {
+					finalImg.Set(x, y, gradient.At(x, y))
+				} else {
+					finalImg.Set(x, y, qr.BackgroundColor)
+				}
+			}
+		}
+
+		img = finalImg
+		timer.mark("gradient")
+	}
+
+	// Reshape the finder patterns, keeping the module mask in step
+	if style, ok := eyeShapes(options); ok {
+		img = applyEyeShapes(img, len(bitmap), options.Border, style, qr.BackgroundColor)
+		base = applyEyeShapes(base, len(bitmap), options.Border, eyeStyle{outer: style.outer, inner: style.inner, outerColor: qr.ForegroundColor, innerColor: qr.ForegroundColor}, qr.BackgroundColor)
+		timer.mark("eye_shapes")
+	}
+
+	// Show a photo through the light areas if specified
+	if options.BackgroundImageURL != "" {
+		photo, err := fetchLogo(options.BackgroundImageURL)
+		if err != nil {
+			return nil, warnings, fetchFailure(err, "background_image_url", "Failed to fetch background image")
+		}
+		fitted, crop := fitBackground(photo, img.Bounds().Size(), options.BackgroundFit, backgroundAnchors[options.BackgroundAlign], qr.BackgroundColor)
+		img = applyBackgroundImage(img, base, qr.ForegroundColor, fitted)
+		centerColor = img.At(img.Bounds().Dx()/2, img.Bounds().Dy()/2)
+		if report != nil {
+			report.backgroundCrop = crop
+		}
+		timer.mark("background")
+	}
+
+	// Draw the dark modules with a tile image if specified
+	if options.ModuleImageURL != "" {
+		tile, err := fetchImage(publicClient, options.ModuleImageURL)
+		if err != nil {
+			return nil, warnings, fetchFailure(err, "module_image_url", "Failed to fetch module image")
+		}
+		img = applyModuleImage(img, bitmap, options.Border, qr.BackgroundColor, tile)
+		timer.mark("module_image")
+	}
+
+	// Fill the background with a decorative pattern if specified
+	if options.BackgroundPattern != "" {
+		img = applyBackgroundPattern(img, base, qr.ForegroundColor, options.BackgroundPattern, parseColor(options.PatternColor))
+		timer.mark("pattern")
+	}
+
+	// Shade the background towards the edges
+	if options.Vignette {
+		img = applyVignette(img, base, qr.ForegroundColor, parseColor(options.VignetteColor))
+		timer.mark("vignette")
+	}
+
+	// Replace the finder pattern centers with an image if specified
+	if options.EyeImageURL != "" {
+		eye, err := fetchLogo(options.EyeImageURL)
+		if err != nil {
+			return nil, warnings, fetchFailure(err, "eye_image_url", "Failed to fetch eye image")
+		}
+
+		warnings = append(warnings, "eye_image_url replaces the finder pattern centers; many scanners rely on them to locate the code, verify before printing")
+		if meanLuminance(eye) > 0.5 {
+			warnings = append(warnings, "eye image is mostly light; finder patterns need dark centers and will likely not be detected")
+		}
+
+		img = applyEyeImages(img, eye, len(bitmap), options.Border, qr.BackgroundColor)
+		timer.mark("eyes")
+	}
+
+	// Embed logo if specified
+	if options.LogoURL != "" {
+		style := logoStyle{
+			sizePercent:  options.LogoSize,
+			plate:        options.LogoPlate,
+			platePadding: options.LogoPadding,
+			plateColor:   qr.BackgroundColor,
+			plateClear:   options.LogoPlateTransparent,
+		}
+		if options.LogoTint != "" {
+			style.tint, style.tintMode = parseColor(options.LogoTint), options.LogoTintMode
+		}
+		if options.LogoBlend > 0 {
+			style.blend, style.blendColor = options.LogoBlend, centerColor
+		}
+		var scale float64
+		img, scale, err = embedLogo(img, options.LogoURL, style)
+		if err != nil {
+			return nil, warnings, fetchFailure(err, "logo_url", "Failed to embed logo")
+		}
+		// With dpi the output pixels are the printed dots, so an enlarged logo prints soft
+		if options.DPI > 0 && scale > 1 {
+			warnings = append(warnings, fmt.Sprintf("logo is enlarged %.1fx to fill its box, so it prints at about %d dpi instead of %d; use a logo at least %.1fx larger",
+				scale, int(float64(options.DPI)/scale), options.DPI, scale))
+		}
+		timer.mark("logo")
+	}
+
+	// Show which modules carry data and which carry error correction, logo included
+	if options.ECOverlay {
+		img = applyECOverlay(img, qr, getErrorCorrection(options.Error), options.Border)
+		timer.mark("ec_overlay")
+	}
+
+	if asymmetric {
+		// The module mask gets plain background margins so it keeps matching only modules
+		symbol := len(qr.Bitmap())
+		img = sides.apply(img, symbol, qr.BackgroundColor)
+		plain := sides
+		plain.colors = [4]string{}
+		base = plain.apply(base, symbol, qr.BackgroundColor)
+		timer.mark("borders")
+	}
+
+	// Decorate the quiet zone with a frame
+	if options.FrameStyle != "" {
+		var framed bool
+		img, framed = applyFrame(img, base, qr.ForegroundColor, options.FrameStyle, parseColor(options.FrameColor), options.FrameDash)
+		if !framed {
+			warnings = append(warnings, "frame_style ignored because the quiet zone is too thin for a frame; increase border or size")
+		}
+		timer.mark("frame")
+	}
+
+	// Add the deployment's attribution mark unless the request is exempt
+	if config.WatermarkText != "" && !options.noWatermark {
+		img = applyWatermark(img, base, qr.ForegroundColor, qr.BackgroundColor)
+		timer.mark("watermark")
+	}
+
+	// Rows above the modules only move down as decorations are added, so they stay free for the trace ID
+	traceRows := 0
+	if options.TraceID != "" {
+		traceRows = moduleBounds(base, qr.ForegroundColor).Min.Y - base.Bounds().Min.Y
+	}
+
+	// Round the corners of the bordered code within its quiet zone
+	if options.BorderRadius > 0 {
+		size := img.Bounds().Size()
+		modules := moduleBounds(base, qr.ForegroundColor).Sub(base.Bounds().Min)
+		radius := min(options.BorderRadius, maxBorderRadius(size, modules))
+		mask := roundedRectMask(size.X, size.Y, radius)
+		// Anti-aliasing can reach a pixel past the corner arc, so back off until modules are clear
+		for radius > 0 && masksModules(mask, modules) {
+			radius--
+			mask = roundedRectMask(size.X, size.Y, radius)
+		}
+		if radius < options.BorderRadius {
+			warnings = append(warnings, fmt.Sprintf("border_radius clamped to %d to keep the modules inside the quiet zone", radius))
+		}
+		if radius > 0 {
+			img = applyMask(img, mask)
+		}
+		timer.mark("border_radius")
+	}
+
+	// Clip the whole image to the requested outline
+	if options.Shape != "" {
+		size := img.Bounds().Size()
+		var mask *image.Alpha
+		if options.Shape == "circle" {
+			mask = circleMask(size.X, size.Y)
+		} else {
+			mask = roundedRectMask(size.X, size.Y, min(size.X, size.Y)/6)
+		}
+		if masksModules(mask, moduleBounds(base, qr.ForegroundColor).Sub(base.Bounds().Min)) {
+			warnings = append(warnings, fmt.Sprintf("shape=%s clips the corners of the code and may prevent scanning; increase border", options.Shape))
+		}
+		img = applyMask(img, mask)
+		timer.mark("shape")
+	}
+
+	// Center the code in a round frame
+	var placement image.Rectangle
+	if options.Layout == "circular" {
+		size := img.Bounds().Size()
+		if side := circularLayoutSide(size.X, size.Y, options.LayoutBorder); side > maxLayoutSide {
+			return nil, warnings, fiber.NewError(400, fmt.Sprintf("layout=circular would make the image %d pixels wide; at most %d fit, so lower size", side, maxLayoutSide))
+		}
+		borderColor := qr.ForegroundColor
+		if options.LayoutBorderColor != "" {
+			borderColor = parseColor(options.LayoutBorderColor)
+		}
+		pitch := float64(base.Bounds().Dx()) / float64(len(bitmap))
+		img, placement = applyCircularLayout(img, qr.BackgroundColor, qr.ForegroundColor, borderColor, options.LayoutFill, options.LayoutBorder, pitch, options.Seed)
+		timer.mark("layout")
+	}
+
+	// Surround the code with a progress ring
+	if options.RingPercent > 0 {
+		img = applyProgressRing(img, qr.BackgroundColor, parseColor(options.RingColor), options.RingPercent, options.RingThickness)
+		timer.mark("ring")
+	}
+
+	// Write the label under the code
+	warnings = append(warnings, resolveCaptionFont(&options)...)
+	if lines := captions(options); len(lines) > 0 {
+		labelColor := qr.ForegroundColor
+		if options.LabelColor != "" {
+			labelColor = parseColor(options.LabelColor)
+		}
+		for _, line := range lines {
+			width := img.Bounds().Dx()
+			img, err = applyLabel(img, line, options.LabelSize, labelColor, qr.BackgroundColor)
+			if err != nil {
+				return nil, warnings, fiber.NewError(500, "Failed to draw label")
+			}
+			// A label wider than the image widens it on both sides
+			placement = placement.Add(image.Pt((img.Bounds().Dx()-width)/2, 0))
+		}
+		timer.mark("label")
+	}
+
+	// Place the code on a rounded card if requested
+	if options.Card {
+		img = applyCard(img, parseColor(options.CardColor), options.CardRadius, options.CardPadding)
+		timer.mark("card")
+	}
+
+	// Round the corners of the final image, leaving them transparent
+	if options.ImageRadius > 0 {
+		size := img.Bounds().Size()
+		img = applyMask(img, roundedRectMask(size.X, size.Y, options.ImageRadius))
+		timer.mark("image_radius")
+	}
+
+	// Add the print bleed outside everything else
+	if options.Bleed > 0 {
+		img = applyBleed(img, options.Bleed, parseColor(options.BleedColor))
+		placement = placement.Add(image.Pt(options.Bleed, options.Bleed))
+		timer.mark("bleed")
+	}
+
+	// Hide the trace ID last, so no later step disturbs its bits
+	if options.TraceID != "" {
+		if img, err = embedTraceID(img, options.TraceID, traceRows); err != nil {
+			return nil, warnings, err
+		}
+		timer.mark("trace")
+	}
+
+	// Scan the finished image, decorations and all
+	if options.Safe {
+		if err := checkReadback(img, options.Data); err != nil {
+			return nil, warnings, err
+		}
+		timer.mark("readback")
+	}
+
+	if report != nil {
+		report.placement = placement
+	}
+
+	return img, warnings, nil
+}
+
+// prepareOptions resolves conflicts, builds the final data and validates the options,
+// returning the warnings collected along the way
+func prepareOptions(options *QRCodeOptions) ([]string, error) {
+	// Resolve conflicting options before validating the result
+	warnings := resolveOptions(options)
+	if options.Safe {
+		warnings = append(warnings, applySafeMode(options)...)
+	}
+
+	// Fill in templated data
+	if options.Vars != "" {
+		data, err := applyTemplate(options.Data, options.Vars)
+		if err != nil {
+			return warnings, err
+		}
+		options.Data = data
+	}
+
+	// Build the payload for typed codes
+	if err := buildPayload(options); err != nil {
+		return warnings, err
+	}
+
+	// Decode binary data
+	if err := decodeData(options); err != nil {
+		return warnings, err
+	}
+
+	// Validation
+	if err := validateOptions(options); err != nil {
+		return warnings, err
+	}
+	if options.AutoType {
+		warnings = append(warnings, typeWarnings(options.Data)...)
+	}
+
+	if options.SVGLink && !isWebURL(options.Data) {
+		warnings = append(warnings, "svg_link ignored because data is not an http or https URL")
+		options.SVGLink = false
+	}
+
+	// Size the logo from the error correction budget of the symbol the data needs
+	if options.LogoAutofit {
+		qr, err := newQRCode(*options)
+		if err != nil {
+			return warnings, err
+		}
+		options.LogoSize = autofitLogoSize(qr, getErrorCorrection(options.Error), *options)
+	}
+
+	if options.Safe {
+		qr, err := newQRCode(*options)
+		if err != nil {
+			return warnings, err
+		}
+		if err := checkSafeOptions(qr, *options); err != nil {
+			return warnings, err
+		}
+	}
+
+	// Printed modules must stay wide enough to scan
+	if options.DPI > 0 {
+		qr, err := newQRCode(*options)
+		if err != nil {
+			return warnings, err
+		}
+		if err := checkPrintSize(qr, options); err != nil {
+			return warnings, err
+		}
+	}
+
+	// Enforce the operator's logo size cap for the error level
+	if limit, ok := config.LogoSizeCaps[options.Error]; ok && options.LogoURL != "" && options.LogoSize > limit {
+		warnings = append(warnings, fmt.Sprintf("logo_size clamped to %g, the maximum for error level %s", limit, options.Error))
+		options.LogoSize = limit
+	}
+
+	return warnings, nil
+}
+
+// handleGenerate serves GET /generate
+func handleGenerate(c *fiber.Ctx) error {
+	timer := newStageTimer()
+	aliasWarnings := expandQueryAliases(c)
+	options, err := parseOptions(c)
+	if err != nil {
+		return err
+	}
+
+	options.noWatermark = watermarkExempt(c.Get("X-API-Key"))
+
+	warnings, err := prepareOptions(&options)
+	if err != nil {
+		return err
+	}
+	warnings = append(aliasWarnings, warnings...)
+	if options.ECOverlay && !c.QueryBool("debug") {
+		warnings = append(warnings, "ec_overlay ignored because debug is not set")
+		options.ECOverlay = false
+	}
+	if options.Type != "" || options.Vars != "" {
+		c.Set("X-QR-Data", options.Data)
+	}
+	if options.AutoType {
+		kind, _ := detectType(options.Data)
+		c.Set("X-QR-Type", kind)
+	}
+	if options.LogoAutofit {
+		c.Set("X-QR-Logo-Size", strconv.FormatFloat(options.LogoSize, 'f', -1, 64))
+	}
+	if options.DPI > 0 {
+		c.Set("X-QR-Module-Size", strconv.FormatFloat(options.modulePixels, 'f', 2, 64))
+		c.Set("X-QR-Module-MM", strconv.FormatFloat(moduleMillimeters(options.modulePixels, options.DPI), 'f', 2, 64))
+	}
+	if c.QueryBool("debug") {
+		c.Set("X-QR-Options", debugOptions(options))
+	}
+
+	// Serve a cached render of the same normalized options when there is one, unless
+	// the client asks for a fresh render that is not kept, as for one-time codes
+	bypass := bypassCache(c)
+	key := cacheKey(options)
+	var out cachedOutput
+	var hit bool
+	if !bypass {
+		out, hit = lookupOutput(key)
+	}
+	if !hit {
+		rendered, renderWarnings, err := renderOutput(options, timer)
+		if err != nil {
+			return err
+		}
+		// Only render warnings follow from the normalized options the key hashes; the
+		// request's own warnings are added below on every response
+		out = rendered
+		out.Warnings = renderWarnings
+		if !bypass {
+			storeOutput(key, out)
+		}
+	}
+	if bypass {
+		// Ask shared caches downstream not to keep the code either
+		c.Set(fiber.HeaderCacheControl, "no-store")
+	}
+	if _, ok := cache.(noCache); !ok {
+		status := "miss"
+		switch {
+		case bypass:
+			status = "bypass"
+		case hit:
+			status = "hit"
+		}
+		c.Set("X-QR-Cache", status)
+	}
+
+	// Report the final dimensions, which decorations and bleed can grow past size
+	if out.Width > 0 {
+		c.Set("X-QR-Width", strconv.Itoa(out.Width))
+		c.Set("X-QR-Height", strconv.Itoa(out.Height))
+	}
+	if options.MaxBytes > 0 {
+		c.Set("X-QR-Bytes", strconv.Itoa(len(out.Body)))
+	}
+	if out.BackgroundCrop != "" {
+		c.Set("X-QR-Background-Crop", out.BackgroundCrop)
+	}
+	if out.Placement != "" {
+		c.Set("X-QR-Placement", out.Placement)
+	}
+	if out.LogoSize > 0 {
+		c.Set("X-QR-Logo-Size", strconv.FormatFloat(out.LogoSize, 'f', -1, 64))
+	}
+
+	return sendOutput(c, timer, append(warnings, out.Warnings...), out.ContentType, out.Body)
+}
+
+// renderOutput renders and encodes the code in the requested format
+func renderOutput(options QRCodeOptions, timer *stageTimer) (cachedOutput, []string, error) {
+	// Formats built from the module matrix skip the raster pipeline
+	if format, ok := matrixFormats[options.Format]; ok {
+		qr, err := newQRCode(options)
+		if err != nil {
+			return cachedOutput{}, nil, err
+		}
+		if err := validateBorder(qr, options); err != nil {
+			return cachedOutput{}, nil, err
+		}
+		warnings := resolveCaptionFont(&options)
+		body, err := format.render(qr, options)
+		if err != nil {
+			return cachedOutput{}, warnings, err
+		}
+		return cachedOutput{ContentType: format.contentType, Body: body}, warnings, nil
+	}
+
+	// Icons render the code once per entry size
+	if options.Format == "ico" {
+		return renderIco(options, timer)
+	}
+
+	timer.mark("parse")
+
+	var report renderReport
+	img, logoSize, warnings, err := renderReadable(options, timer, &report)
+	if err != nil {
+		return cachedOutput{}, warnings, err
+	}
+
+	body, contentType, err := encodeImage(img, options)
+	if err != nil {
+		return cachedOutput{}, warnings, err
+	}
+
+	// Shrink the output until it fits the client's byte budget
+	if options.MaxBytes > 0 && len(body) > options.MaxBytes {
+		var budgetWarnings []string
+		rendered := img.Bounds().Size()
+		body, img, budgetWarnings, err = fitByteBudget(img, options)
+		warnings = append(warnings, budgetWarnings...)
+		if err != nil {
+			return cachedOutput{}, warnings, err
+		}
+		report.placement = scaleRect(report.placement, rendered, img.Bounds().Size())
+		timer.mark("budget")
+	}
+
+	bounds := img.Bounds()
+	out := cachedOutput{ContentType: contentType, Body: body, Width: bounds.Dx(), Height: bounds.Dy()}
+	if logoSize != options.LogoSize {
+		out.LogoSize = logoSize
+	}
+	if options.BackgroundImageURL != "" {
+		out.BackgroundCrop = formatRect(report.backgroundCrop)
+	}
+	if options.Layout != "" {
+		out.Placement = formatRect(report.placement)
+	}
+	return out, warnings, nil
+}
+
+// jpegMatte returns the opaque color transparent pixels are flattened onto for JPEG
+// output: the background, itself flattened onto white when it is translucent
+func jpegMatte(background string) color.RGBA {
+	return flattenColor(parseColor(background), color.White)
+}
+
+// encodeImage encodes the finished image as PNG or JPEG.
+//
+// image/jpeg always subsamples chroma 4:2:0 and has no option for 4:4:4, so JPEG output
+// keeps brightness at full resolution but color at half. Scanners binarize on brightness,
+// so dark modules on a light background read the same either way, but the edges between
+// two colors of similar brightness, such as a colored logo against colored modules, blur
+// over a pixel or two. PNG keeps every edge exact in a larger file; 4:4:4 JPEG would need
+// a different encoder.
+func encodeImage(img image.Image, options QRCodeOptions) ([]byte, string, error) {
+	var finalBuf bytes.Buffer
+	contentType := "image/png"
+	switch options.Format {
+	case "jpeg":
+		// JPEG has no alpha channel, so flatten onto the background color first
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(jpegMatte(options.Background)), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&finalBuf, flat, &jpeg.Options{Quality: options.Quality}); err != nil {
+			return nil, "", fiber.NewError(500, "Failed to encode final image")
+		}
+		if options.Orientation > 0 {
+			tagged, err := withJPEGOrientation(finalBuf.Bytes(), options.Orientation)
+			if err != nil {
+				return nil, "", fiber.NewError(500, "Failed to write JPEG orientation")
+			}
+			return tagged, "image/jpeg", nil
+		}
+		contentType = "image/jpeg"
+	default:
+		if err := png.Encode(&finalBuf, img); err != nil {
+			return nil, "", fiber.NewError(500, "Failed to encode final image")
+		}
+	}
+
+	body := finalBuf.Bytes()
+	if options.DPI > 0 && contentType == "image/png" {
+		tagged, err := withPNGResolution(body, options.DPI)
+		if err != nil {
+			return nil, "", fiber.NewError(500, "Failed to write PNG resolution")
+		}
+		body = tagged
+	}
+	if options.Format == "gocode" {
+		bounds := img.Bounds()
+		return renderGoCode(body, options.GoPackage, options.GoVar, options.Data, bounds.Dx(), bounds.Dy()), "text/plain; charset=utf-8", nil
+	}
+	return body, contentType, nil
+}
+
+// sendOutput writes the encoded body along with the warning and debug headers
+func sendOutput(c *fiber.Ctx, timer *stageTimer, warnings []string, contentType string, body []byte) error {
+	timer.mark("output")
+
+	if c.QueryBool("debug") {
+		c.Set("X-QR-Timing", timer.String())
+	}
+	setWarnings(c, warnings)
+
+	c.Set("Content-Type", contentType)
+	return c.Send(body)
+}
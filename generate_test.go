@@ -0,0 +1,74 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// testOptions returns the default options encoding data
+func testOptions(data string) QRCodeOptions {
+	options := defaultOptions
+	options.Data = data
+	return options
+}
+
+// renderCode prepares the options as GET /generate does and renders the image
+func renderCode(t *testing.T, options QRCodeOptions) image.Image {
+	t.Helper()
+	if _, err := prepareOptions(&options); err != nil {
+		t.Fatalf("prepareOptions: %v", err)
+	}
+	img, _, err := generateImage(options, nil, nil)
+	if err != nil {
+		t.Fatalf("generateImage: %v", err)
+	}
+	return img
+}
+
+// assertDecodes fails the test unless img decodes to data
+func assertDecodes(t *testing.T, img image.Image, data string) {
+	t.Helper()
+	got, err := decodeImage(img)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(got) != data {
+		t.Fatalf("decoded %q, want %q", got, data)
+	}
+}
+
+func TestGenerateImageDecodes(t *testing.T) {
+	for _, level := range []string{"L", "M", "Q", "H"} {
+		options := testOptions("https://example.com/path?q=1")
+		options.Error = level
+		assertDecodes(t, renderCode(t, options), options.Data)
+	}
+}
+
+func TestBorderModules(t *testing.T) {
+	for _, border := range []int{0, 1, 4, 10} {
+		// A version 4 symbol, wide enough for a border of 10 to stay below maxBorderPercent
+		options := testOptions("https://example.com/a/path/long/enough/for/version/4")
+		options.Border = border
+		qr, err := newQRCode(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		symbol := len(qr.Bitmap())
+		// Ten pixels per module of the symbol and its quiet zone
+		options.Size = (symbol + 2*border) * 10
+		img := renderCode(t, options)
+
+		if got := img.Bounds().Dx(); got != options.Size {
+			t.Errorf("border=%d: image is %d pixels wide, want %d", border, got, options.Size)
+		}
+		modules := moduleBounds(img, parseColor(options.Foreground))
+		want := image.Rect(border*10, border*10, (symbol+border)*10, (symbol+border)*10)
+		if modules != want {
+			t.Errorf("border=%d: modules span %v, want %v", border, modules, want)
+		}
+		if border > 0 {
+			assertDecodes(t, img, options.Data)
+		}
+	}
+}
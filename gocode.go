@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"strconv"
+)
+
+// goCodeBytesPerLine is the number of bytes written on each line of the slice literal
+const goCodeBytesPerLine = 16
+
+// renderGoCode wraps PNG data in Go source declaring it as a byte slice named name in
+// package pkg. The bytes are written as hex literals and the data is quoted in the doc
+// comment, so no input can break out of the literal or the comment.
+func renderGoCode(pngData []byte, pkg, name, data string, width, height int) []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by qrcode-api. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "// %s is a %dx%d PNG QR code encoding %s.\n", name, width, height, strconv.QuoteToASCII(truncateText(data, 60)))
+	fmt.Fprintf(&b, "var %s = []byte{", name)
+	for i, v := range pngData {
+		if i%goCodeBytesPerLine == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "0x%02x,", v)
+	}
+	b.WriteString("\n}\n")
+	return b.Bytes()
+}
+
+// isGoIdentifier reports whether name can be declared as a Go package or variable name
+func isGoIdentifier(name string) bool {
+	return token.IsIdentifier(name) && name != "_"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// gradientVector is a linear gradient's start and end point in coordinates normalized to the image, 0 to 1
+type gradientVector struct {
+	x1, y1, x2, y2 float64
+}
+
+// angleVector returns the vector for a gradient running along angle degrees, clockwise from
+// left to right, with its ends where the image corners project onto that direction
+func angleVector(angle float64) gradientVector {
+	dirX, dirY := math.Cos(angle*math.Pi/180), math.Sin(angle*math.Pi/180)
+	extent := (math.Abs(dirX) + math.Abs(dirY)) / 2
+	return gradientVector{0.5 - dirX*extent, 0.5 - dirY*extent, 0.5 + dirX*extent, 0.5 + dirY*extent}
+}
+
+// parsePoint parses a normalized "x,y" coordinate pair
+func parsePoint(s string) (x, y float64, ok bool) {
+	xs, ys, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, false
+	}
+	x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 64)
+	return x, y, errX == nil && errY == nil
+}
+
+// gradientDirection returns the linear gradient vector: gradient_from and gradient_to when
+// both are given, otherwise the one set by gradient_angle
+func gradientDirection(options QRCodeOptions) gradientVector {
+	if options.GradientFrom != "" && options.GradientTo != "" {
+		x1, y1, _ := parsePoint(options.GradientFrom)
+		x2, y2, _ := parsePoint(options.GradientTo)
+		return gradientVector{x1, y1, x2, y2}
+	}
+	return angleVector(options.GradientAngle)
+}
+
+// ratio projects the normalized point onto the vector, clamped to 0 at the start and 1 at the end
+func (v gradientVector) ratio(x, y float64) float64 {
+	dx, dy := v.x2-v.x1, v.y2-v.y1
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return 0
+	}
+	t := ((x-v.x1)*dx + (y-v.y1)*dy) / length
+	return math.Max(0, math.Min(t, 1.0))
+}
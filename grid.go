@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxGridItems bounds the number of codes laid out by one grid request
+const maxGridItems = 256
+
+// maxGridSide is the largest width or height of a grid, labels included
+const maxGridSide = 8192
+
+// gridRequest is the body of POST /generate/grid. Options are shared by every cell, and
+// each item is a {data, label} object that may override other options too.
+type gridRequest struct {
+	Options  json.RawMessage   `json:"options"`
+	Items    []json.RawMessage `json:"items"`
+	CellSize int               `json:"cell_size"`
+	Columns  int               `json:"columns"`
+	Spacing  int               `json:"spacing"`
+	Format   string            `json:"format"` // "png" or "pdf"
+}
+
+// handleGrid serves POST /generate/grid, composing one image with a code per cell and
+// each code's label beneath it, for comparing codes side by side. The PDF is a single
+// page at one point per pixel.
+func handleGrid(c *fiber.Ctx) error {
+	req := gridRequest{CellSize: 256, Spacing: 16, Format: "png"}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(400, "Body must be a JSON grid request")
+	}
+
+	if len(req.Items) == 0 || len(req.Items) > maxGridItems {
+		return fiber.NewError(400, fmt.Sprintf("items must contain between 1 and %d entries", maxGridItems))
+	}
+	if req.CellSize < 21 || req.CellSize > 1024 {
+		return fiber.NewError(400, "cell_size must be between 21 and 1024")
+	}
+	if req.Spacing < 0 || req.Spacing > 256 {
+		return fiber.NewError(400, "spacing must be between 0 and 256")
+	}
+	if req.Format != "png" && req.Format != "pdf" {
+		return fiber.NewError(400, "format must be one of png, pdf")
+	}
+	if req.Columns <= 0 {
+		req.Columns = int(math.Ceil(math.Sqrt(float64(len(req.Items)))))
+	}
+	req.Columns = min(req.Columns, len(req.Items))
+	rows := (len(req.Items) + req.Columns - 1) / req.Columns
+	if side := max(req.Columns, rows)*(req.CellSize+req.Spacing) - req.Spacing; side > maxGridSide {
+		return fiber.NewError(400, fmt.Sprintf("grid would be %d pixels wide; at most %d fit, so lower cell_size or columns", side, maxGridSide))
+	}
+
+	items, err := decodeItems(c, req.Options, req.Items, req.CellSize)
+	if err != nil {
+		return err
+	}
+	images, err := generateItems(items)
+	if err != nil {
+		return err
+	}
+
+	// Labels make cells taller than they are wide, so rows take the height of the tallest cell
+	cellHeight := 0
+	for i, img := range images {
+		// A label or decoration wider than the code widens the image, so fit it back into the column
+		if img.Bounds().Dx() > req.CellSize {
+			images[i] = imaging.Resize(img, req.CellSize, 0, imaging.Lanczos)
+		}
+		cellHeight = max(cellHeight, images[i].Bounds().Dy())
+	}
+
+	// Items are validated like GET /generate, so each label is bounded by maxLabelLength,
+	// but labels still make rows taller than the check before rendering assumed
+	width := req.Columns*req.CellSize + (req.Columns-1)*req.Spacing
+	height := rows*cellHeight + (rows-1)*req.Spacing
+	if height > maxGridSide {
+		return fiber.NewError(400, fmt.Sprintf("grid would be %d pixels tall with its labels; at most %d fit, so lower cell_size, label_size or the number of rows", height, maxGridSide))
+	}
+	grid := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(grid, grid.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, img := range images {
+		size := img.Bounds().Size()
+		x := (i%req.Columns)*(req.CellSize+req.Spacing) + (req.CellSize-size.X)/2
+		y := (i / req.Columns) * (cellHeight + req.Spacing)
+		draw.Draw(grid, image.Rect(x, y, x+size.X, y+size.Y), img, img.Bounds().Min, draw.Over)
+	}
+
+	c.Set("X-QR-Grid-Columns", strconv.Itoa(req.Columns))
+	c.Set("X-QR-Grid-Rows", strconv.Itoa(rows))
+	c.Set("X-QR-Width", strconv.Itoa(width))
+	c.Set("X-QR-Height", strconv.Itoa(height))
+
+	var buf bytes.Buffer
+	if req.Format == "png" {
+		if err := png.Encode(&buf, grid); err != nil {
+			return fiber.NewError(500, "Failed to encode grid")
+		}
+		c.Set("Content-Type", "image/png")
+		return c.Send(buf.Bytes())
+	}
+
+	page := []pdfImage{{grid, 0, 0, float64(width), float64(height)}}
+	if err := writePDF(&buf, float64(width), float64(height), [][]pdfImage{page}); err != nil {
+		return fiber.NewError(500, "Failed to encode grid")
+	}
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", `attachment; filename="grid.pdf"`)
+	return c.Send(buf.Bytes())
+}
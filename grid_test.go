@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// postGrid sends a grid request, returning the status and the error message
+func postGrid(t *testing.T, req map[string]any) (int, string) {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler, BodyLimit: maxSpriteBodySize})
+	app.Post("/generate/grid", handleGrid)
+	resp, err := app.Test(httptest.NewRequest("POST", "/generate/grid", strings.NewReader(string(body))), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded.Error
+}
+
+// gridLabels returns n grid items with labels of the given length
+func gridLabels(n, length int) []map[string]string {
+	items := make([]map[string]string, n)
+	for i := range items {
+		items[i] = map[string]string{"data": fmt.Sprintf("https://example.com/%d", i), "label": strings.Repeat("x", length)}
+	}
+	return items
+}
+
+func TestGridBoundsLabels(t *testing.T) {
+	loadTestFonts(t)
+
+	if status, _ := postGrid(t, map[string]any{"items": gridLabels(4, 10)}); status != 200 {
+		t.Fatalf("labeled grid: status %d", status)
+	}
+	if status, msg := postGrid(t, map[string]any{"items": gridLabels(4, maxLabelLength+1)}); status != 400 {
+		t.Errorf("overlong label: status %d (%s), want 400", status, msg)
+	}
+
+	// Seven rows of 1024 pixel cells fit before labels, but not with a 200 pixel label under each
+	req := map[string]any{"items": gridLabels(7, 2), "columns": 1, "cell_size": 1024, "options": map[string]any{"label_size": 200}}
+	if status, msg := postGrid(t, req); status != 400 || !strings.Contains(msg, "with its labels") {
+		t.Errorf("tall grid: status %d (%s), want 400", status, msg)
+	}
+}
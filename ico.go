@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIcoEntries bounds the number of sizes packed into one icon
+const maxIcoEntries = 8
+
+// minIcoSize is the smallest icon entry; favicons below it are never requested by browsers
+const minIcoSize = 16
+
+// parseIcoSizes parses a comma separated list of distinct icon sizes, each between 16 and 256 pixels
+func parseIcoSizes(list string) ([]int, error) {
+	var sizes []int
+	for _, part := range strings.Split(list, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || size < minIcoSize || size > 256 {
+			return nil, fiber.NewError(400, fmt.Sprintf("sizes must be a comma separated list of values between %d and 256", minIcoSize))
+		}
+		if slices.Contains(sizes, size) {
+			return nil, fiber.NewError(400, fmt.Sprintf("sizes lists %d more than once", size))
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) > maxIcoEntries {
+		return nil, fiber.NewError(400, fmt.Sprintf("sizes must list at most %d values", maxIcoEntries))
+	}
+	return sizes, nil
+}
+
+// renderIco renders the code at every icon size, so each entry is drawn on the pixel grid
+// instead of scaled from one large image, and packs the entries into an ICO file. Sizes
+// below the module count cannot show every module and are downscaled from the smallest
+// render that can, which blurs them.
+func renderIco(options QRCodeOptions, timer *stageTimer) (cachedOutput, []string, error) {
+	sizes, err := parseIcoSizes(options.Sizes)
+	if err != nil {
+		return cachedOutput{}, nil, err
+	}
+	qr, err := newQRCode(options)
+	if err != nil {
+		return cachedOutput{}, nil, err
+	}
+	modules := len(moduleMatrix(qr, options.Border))
+	timer.mark("parse")
+
+	var warnings []string
+	if slices.Min(sizes) < modules {
+		warnings = append(warnings, fmt.Sprintf("icon sizes below %d pixels cannot show every module and are downscaled", modules))
+	}
+	images := make([]image.Image, len(sizes))
+	for i, size := range sizes {
+		entry := options
+		entry.Size = size
+		img, renderWarnings, err := generateImage(entry, timer, nil)
+		for _, warning := range renderWarnings {
+			if !slices.Contains(warnings, warning) {
+				warnings = append(warnings, warning)
+			}
+		}
+		if err != nil {
+			return cachedOutput{}, warnings, err
+		}
+
+		// Decorations such as rings or cards enlarge the image, so fit it back into the entry
+		if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+			img = imaging.Fit(img, size, size, imaging.Box)
+		}
+		images[i] = img
+	}
+
+	var buf bytes.Buffer
+	if err := encodeIco(&buf, images); err != nil {
+		return cachedOutput{}, warnings, fiber.NewError(500, "Failed to encode final image")
+	}
+	largest := slices.Max(sizes)
+	return cachedOutput{ContentType: "image/x-icon", Body: buf.Bytes(), Width: largest, Height: largest}, warnings, nil
+}
+
+// encodeIco writes an ICO file holding one PNG-compressed entry per square image
+func encodeIco(w io.Writer, entries []image.Image) error {
+	images := make([][]byte, len(entries))
+	sizes := make([]int, len(entries))
+	for i, img := range entries {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		images[i] = buf.Bytes()
+		sizes[i] = img.Bounds().Dx()
+	}
+
+	// ICONDIR header: reserved, type (1 = icon), image count
+	header := []uint16{0, 1, uint16(len(sizes))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	// ICONDIRENTRY per image, data follows the header and all entries
+	offset := 6 + 16*len(sizes)
+	for i, size := range sizes {
+		dimension := uint8(size)
+		if size == 256 {
+			dimension = 0 // 0 means 256 in the ICO format
+		}
+		entry := struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, BitCount                uint16
+			Size, Offset                    uint32
+		}{dimension, dimension, 0, 0, 1, 32, uint32(len(images[i])), uint32(offset)}
+		if err := binary.Write(w, binary.LittleEndian, entry); err != nil {
+			return err
+		}
+		offset += len(images[i])
+	}
+
+	for _, data := range images {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestRenderIcoDirectory(t *testing.T) {
+	options := defaultOptions
+	options.Data = "https://example.com"
+	options.Format = "ico"
+	options.Sizes = "16,32,48,256"
+
+	out, _, err := renderIco(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ContentType != "image/x-icon" {
+		t.Errorf("content type = %q", out.ContentType)
+	}
+
+	ico := out.Body
+	if reserved, kind, count := binary.LittleEndian.Uint16(ico), binary.LittleEndian.Uint16(ico[2:]), binary.LittleEndian.Uint16(ico[4:]); reserved != 0 || kind != 1 || count != 4 {
+		t.Fatalf("ICONDIR = %d, %d, %d; want 0, 1, 4", reserved, kind, count)
+	}
+
+	for i, want := range []int{16, 32, 48, 256} {
+		entry := ico[6+16*i:]
+		width, height := int(entry[0]), int(entry[1])
+		if width == 0 {
+			width = 256
+		}
+		if height == 0 {
+			height = 256
+		}
+		if width != want || height != want {
+			t.Errorf("entry %d is %dx%d, want %dx%d", i, width, height, want, want)
+		}
+		if planes, bits := binary.LittleEndian.Uint16(entry[4:]), binary.LittleEndian.Uint16(entry[6:]); planes != 1 || bits != 32 {
+			t.Errorf("entry %d has %d planes at %d bits, want 1 at 32", i, planes, bits)
+		}
+
+		// Each entry points at a PNG of its own size
+		size, offset := binary.LittleEndian.Uint32(entry[8:]), binary.LittleEndian.Uint32(entry[12:])
+		if int(offset+size) > len(ico) {
+			t.Fatalf("entry %d runs past the end of the file", i)
+		}
+		img, err := png.Decode(bytes.NewReader(ico[offset : offset+size]))
+		if err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		if img.Bounds() != image.Rect(0, 0, want, want) {
+			t.Errorf("entry %d image is %v, want %dx%d", i, img.Bounds(), want, want)
+		}
+	}
+}
+
+func TestParseIcoSizes(t *testing.T) {
+	for _, list := range []string{"8", "16,16", "16,300", "16,x", "16,20,24,28,32,36,40,44,48"} {
+		if _, err := parseIcoSizes(list); err == nil {
+			t.Errorf("parseIcoSizes(%q) accepted invalid sizes", list)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+
+	"github.com/disintegration/imaging"
+)
+
+// Jittered modules shrink to at most maxJitterShrink of their size and move off center by
+// at most maxJitterShift of a module. The shrunk half width always exceeds the shift, so
+// every dark module still covers its own center, where scanners sample.
+const (
+	maxJitterShrink = 0.3
+	maxJitterShift  = 0.15
+)
+
+// module_gap is a percentage of the module size. At maxModuleGap the half width of a fully
+// jittered module, (1-0.5)*(1-0.3)/2 = 0.175, still exceeds the shift; past maxSafeModuleGap
+// the modules are small enough that some scanners stop reading them.
+const (
+	maxModuleGap     = 50
+	maxSafeModuleGap = 30
+)
+
+// isTimingModule reports whether module (x, y) of a symbol offset by quiet zone q lies on
+// the row or column of the timing patterns
+func isTimingModule(x, y, q int) bool {
+	return x-q == 6 || y-q == 6
+}
+
+// moduleSamples maps module_quality to the supersampling factor per axis
+var moduleSamples = map[string]int{"fast": 1, "balanced": 2, "best": 4}
+
+// maxSupersampleSide is the largest side a supersampled matrix is drawn at; bigger codes
+// use fewer samples
+const maxSupersampleSide = 4096
+
+// moduleStyle holds the parameters of renderJitteredMatrix
+type moduleStyle struct {
+	jitter  float64 // 0..1 share of the safe bounds each data module varies by
+	gap     float64 // 0..1 share of the cell left clear around every dark module
+	samples int     // supersampling factor per axis, 1 draws at the final size
+	seed    int64
+}
+
+// renderJitteredMatrix draws the module matrix like renderMatrix, but varies the size and
+// position of each dark data module by up to style.jitter of the safe bounds, using a
+// deterministic random source so the same seed and data always yield the same image.
+// Finder and timing patterns stay on the exact grid. Every dark module outside the finder
+// patterns is then inset by style.gap of its cell, leaving clear space between neighbors;
+// finder patterns stay solid, as scanners locate the code by their run lengths. Modules no longer fall
+// on pixel boundaries, so they are drawn style.samples times larger and scaled down,
+// smoothing their edges.
+func renderJitteredMatrix(bitmap [][]bool, size int, fg, bg color.Color, quietZone int, style moduleStyle) *image.RGBA {
+	modules := len(bitmap)
+	symbol := modules - 2*quietZone
+	size = max(size, modules)
+	samples := max(1, min(style.samples, maxSupersampleSide/size))
+	final, size := size, size*samples
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	paint := image.NewUniform(fg)
+
+	// Draw modules in row-major order so the jitter does not depend on image size
+	rng := rand.New(rand.NewSource(style.seed))
+	cell := float64(size) / float64(modules)
+	for my, row := range bitmap {
+		for mx, dark := range row {
+			if !dark {
+				continue
+			}
+			scale, gap, dx, dy := 1.0, style.gap, 0.0, 0.0
+			if isFinderModule(mx, my, symbol, quietZone) {
+				gap = 0
+			} else if !isTimingModule(mx, my, quietZone) {
+				scale = 1 - rng.Float64()*maxJitterShrink*style.jitter
+				dx = (rng.Float64()*2 - 1) * maxJitterShift * style.jitter
+				dy = (rng.Float64()*2 - 1) * maxJitterShift * style.jitter
+			}
+
+			cx, cy := (float64(mx)+0.5+dx)*cell, (float64(my)+0.5+dy)*cell
+			half := (1 - gap) * scale * cell / 2
+			rect := image.Rect(int(cx-half+0.5), int(cy-half+0.5), int(cx+half+0.5), int(cy+half+0.5))
+			draw.Draw(img, rect, paint, image.Point{}, draw.Src)
+		}
+	}
+	if samples == 1 {
+		return img
+	}
+
+	// A box filter averages each block of samples into one pixel
+	scaled := imaging.Resize(img, final, final, imaging.Box)
+	result := image.NewRGBA(scaled.Bounds())
+	draw.Draw(result, result.Bounds(), scaled, image.Point{}, draw.Src)
+	return result
+}
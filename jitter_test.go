@@ -0,0 +1,39 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestJitteredModulesDecode(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3} {
+		for _, jitter := range []float64{0.5, 1} {
+			options := testOptions("https://example.com/jittered")
+			options.ModuleJitter = jitter
+			options.Seed = seed
+			assertDecodes(t, renderCode(t, options), options.Data)
+		}
+	}
+}
+
+func TestJitterIsDeterministic(t *testing.T) {
+	options := testOptions("https://example.com/jittered")
+	options.ModuleJitter = 1
+	options.Seed = 7
+	first := renderCode(t, options).(*image.RGBA)
+	second := renderCode(t, options).(*image.RGBA)
+	if string(first.Pix) != string(second.Pix) {
+		t.Error("the same seed rendered different images")
+	}
+}
+
+func TestGappedModulesDecode(t *testing.T) {
+	for _, gap := range []float64{10, maxSafeModuleGap} {
+		for _, jitter := range []float64{0, 1} {
+			options := testOptions("https://example.com/jittered")
+			options.ModuleGap = gap
+			options.ModuleJitter = jitter
+			assertDecodes(t, renderCode(t, options), options.Data)
+		}
+	}
+}
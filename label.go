@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/go-text/typesetting/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/gofont/gosmallcaps"
+)
+
+// fallbackTTF covers the scripts the Go fonts lack, such as Hebrew and Arabic
+//
+//go:embed fonts/DejaVuSans.ttf
+var fallbackTTF []byte
+
+// captionFace is a typeface captions can be drawn in
+type captionFace struct {
+	font   *font.Font
+	family string // CSS font-family used for SVG output
+	data   []byte // font file SVG output embeds, set for downloaded fonts only
+}
+
+// captionFaces maps caption_font names to the bundled typefaces, filled by loadFonts
+var captionFaces = map[string]*captionFace{}
+
+// monoFont is the typeface used for the human-readable data line
+var monoFont *font.Font
+
+// fallbackFont supplies glyphs missing from the caption fonts
+var fallbackFont *font.Font
+
+// bundledFonts lists the fonts parsed at startup and the characters each must render
+var bundledFonts = []struct {
+	name, family string
+	data         []byte
+	check        string
+}{
+	{"go", "Go, sans-serif", goregular.TTF, "Ag0…�"},
+	{"go-medium", "Go Medium, sans-serif", gomedium.TTF, "Ag0…�"},
+	{"go-bold", "Go Bold, sans-serif", gobold.TTF, "Ag0…�"},
+	{"go-italic", "Go Italic, sans-serif", goitalic.TTF, "Ag0…�"},
+	{"go-smallcaps", "Go Smallcaps, sans-serif", gosmallcaps.TTF, "Ag0…�"},
+	{"go-mono", "Go Mono, monospace", gomono.TTF, "Ag0…�"},
+	{"dejavu-sans", "DejaVu Sans, sans-serif", fallbackTTF, "Ag0אبا"},
+}
+
+// bundledFontNames returns the caption_font values, in the order of bundledFonts
+func bundledFontNames() []string {
+	names := make([]string, len(bundledFonts))
+	for i, f := range bundledFonts {
+		names[i] = f.name
+	}
+	return names
+}
+
+// loadFonts parses the bundled caption fonts and checks each can render the
+// characters captions rely on, so a broken build fails at startup instead of per request
+func loadFonts() error {
+	for _, f := range bundledFonts {
+		face, err := font.ParseTTF(bytes.NewReader(f.data))
+		if err != nil {
+			return fmt.Errorf("font %s: %w", f.name, err)
+		}
+		for _, r := range f.check {
+			if _, ok := face.NominalGlyph(r); !ok {
+				return fmt.Errorf("font %s has no glyph for %q", f.name, r)
+			}
+		}
+		captionFaces[f.name] = &captionFace{font: face.Font, family: f.family}
+	}
+	monoFont = captionFaces["go-mono"].font
+	fallbackFont = captionFaces["dejavu-sans"].font
+	return nil
+}
+
+// maxLabelLength bounds the characters of a label
+const maxLabelLength = 200
+
+// maxFetchedFonts bounds the downloaded fonts kept parsed between requests
+const maxFetchedFonts = 32
+
+// fetchedFonts caches downloaded caption fonts by URL, so repeated requests reuse
+// one parsed font and the shapers' faces for it
+var fetchedFonts = struct {
+	sync.Mutex
+	faces map[string]*captionFace
+}{faces: make(map[string]*captionFace)}
+
+// fetchCaptionFont downloads and parses a TrueType or OpenType font from a public host
+func fetchCaptionFont(fontURL string) (*captionFace, error) {
+	fetchedFonts.Lock()
+	face, ok := fetchedFonts.faces[fontURL]
+	fetchedFonts.Unlock()
+	if ok {
+		return face, nil
+	}
+
+	data, err := fetchBytes(publicClient, fontURL)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := font.ParseTTF(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := parsed.NominalGlyph('A'); !ok {
+		return nil, fmt.Errorf("font has no Latin letters")
+	}
+	face = &captionFace{font: parsed.Font, family: "qr-caption, sans-serif", data: data}
+
+	fetchedFonts.Lock()
+	if len(fetchedFonts.faces) >= maxFetchedFonts {
+		clear(fetchedFonts.faces)
+	}
+	fetchedFonts.faces[fontURL] = face
+	fetchedFonts.Unlock()
+	return face, nil
+}
+
+// resolveCaptionFont picks the typeface for the label: the downloaded caption_font_url
+// when it loads, else the bundled caption_font. It returns a warning when the download
+// falls back.
+func resolveCaptionFont(options *QRCodeOptions) []string {
+	if options.Label == "" || options.CaptionFontURL == "" || options.captionFace != nil {
+		return nil
+	}
+	face, err := fetchCaptionFont(options.CaptionFontURL)
+	if err != nil {
+		options.CaptionFontURL = ""
+		return []string{fmt.Sprintf("caption_font_url could not be loaded as a TrueType or OpenType font; using caption_font=%s", options.CaptionFont)}
+	}
+	options.captionFace = face
+	return nil
+}
+
+// caption is one line of text drawn in a strip below the code
+type caption struct {
+	text   string
+	fonts  []*font.Font // tried in order for every character
+	family string       // CSS font-family used for SVG output
+	rtl    bool         // lays the line out right to left
+	embed  []byte       // font file SVG output embeds for family
+}
+
+// captions returns the lines drawn below the code, top to bottom: the data line
+// for show_text, then the label
+func captions(options QRCodeOptions) []caption {
+	var lines []caption
+	if options.ShowText {
+		text := truncateText(options.Data, options.ShowTextMax)
+		lines = append(lines, caption{text, []*font.Font{monoFont, fallbackFont}, "Go Mono, monospace", isRightToLeft(text, "auto"), nil})
+	}
+	if options.Label != "" {
+		face := options.captionFace
+		if face == nil {
+			face = captionFaces[options.CaptionFont]
+		}
+		lines = append(lines, caption{options.Label, []*font.Font{face.font, fallbackFont}, face.family, isRightToLeft(options.Label, options.LabelDir), face.data})
+	}
+	return lines
+}
+
+// truncateText shortens text to at most limit characters, ending it with an ellipsis when cut.
+// Invalid UTF-8, as left by binary data, is shown as replacement characters.
+func truncateText(text string, limit int) string {
+	runes := []rune(strings.ToValidUTF8(text, "�"))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// labelStripHeight returns the height in pixels of the strip holding a label of the given font size
+func labelStripHeight(fontSize float64) int {
+	return int(math.Ceil(fontSize * 1.6))
+}
+
+// applyLabel extends the image with a background-colored strip below it holding the centered line.
+// The canvas is widened when the line is wider than the code, keeping the code centered,
+// but never past maxLayoutSide; a longer line is clipped at both ends.
+func applyLabel(img image.Image, line caption, fontSize float64, fg, bg color.Color) (image.Image, error) {
+	shaper := shapers.Get().(*textShaper)
+	defer shapers.Put(shaper)
+	shaped := shaper.shape(line, fontSize)
+	if len(shaped.runs) == 0 {
+		return nil, fmt.Errorf("label %q could not be shaped", line.text)
+	}
+
+	size := img.Bounds().Size()
+	strip := labelStripHeight(fontSize)
+	textW := shaped.width.Ceil()
+	width := max(size.X, min(textW+strip, maxLayoutSide))
+
+	result := image.NewRGBA(image.Rect(0, 0, width, size.Y+strip))
+	draw.Draw(result, result.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	left := (width - size.X) / 2
+	draw.Draw(result, image.Rect(left, 0, left+size.X, size.Y), img, img.Bounds().Min, draw.Over)
+
+	// Center the text's ascent and descent vertically in the strip
+	baseline := float32(strip+shaped.ascent.Ceil()-shaped.descent.Ceil()) / 2
+	mask := shaped.rasterize(width, strip, float32(width-textW)/2, baseline)
+	draw.DrawMask(result, image.Rect(0, size.Y, width, size.Y+strip), image.NewUniform(fg), image.Point{}, mask, image.Point{}, draw.Over)
+
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// loadTestFonts loads the bundled caption fonts, as main does at startup
+func loadTestFonts(t *testing.T) {
+	t.Helper()
+	if err := loadFonts(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSVGLabelText(t *testing.T) {
+	loadTestFonts(t)
+	options := testOptions("hello")
+	options.Format = "svg"
+	options.Label = "Scan <me>"
+	options.LabelColor = "red"
+	options.LabelSize = 30
+	if _, err := prepareOptions(&options); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := renderOutput(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := regexp.MustCompile(`<text ([^>]*)>([^<]*)</text>`).FindStringSubmatch(string(out.Body))
+	if text == nil {
+		t.Fatalf("no <text> element in %s", out.Body)
+	}
+	if text[2] != "Scan &lt;me&gt;" {
+		t.Errorf("text content %q, want the escaped label", text[2])
+	}
+	// The viewBox is in modules: 21 plus a border of 4 on each side, across 300 pixels
+	modules := 29.0
+	unit := modules / float64(options.Size)
+	for _, attr := range []string{
+		`fill="#ff0000"`,
+		`text-anchor="middle"`,
+		fmt.Sprintf(`x="%s"`, svgNumber(modules/2)),
+		fmt.Sprintf(`font-size="%s"`, svgNumber(30*unit)),
+	} {
+		if !strings.Contains(text[1], attr) {
+			t.Errorf("<text %s> lacks %s", text[1], attr)
+		}
+	}
+}
+
+func TestLabelLengthIsBounded(t *testing.T) {
+	loadTestFonts(t)
+	options := testOptions("hello")
+	options.Label = strings.Repeat("W", maxLabelLength+1)
+	if _, err := prepareOptions(&options); err == nil {
+		t.Errorf("a %d character label passed validation", maxLabelLength+1)
+	}
+
+	// The longest label at the largest size stops widening the canvas at maxLayoutSide
+	options.Label = options.Label[1:]
+	line := captions(options)[0]
+	img, err := applyLabel(image.NewRGBA(image.Rect(0, 0, 300, 300)), line, 200, color.Black, color.White)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width := img.Bounds().Dx(); width != maxLayoutSide {
+		t.Errorf("label widened the image to %d, want %d", width, maxLayoutSide)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// linkCodeLength is the number of characters in a generated short code
+const linkCodeLength = 8
+
+// linkCodeAlphabet holds the characters short codes are drawn from
+const linkCodeAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxLinkTargetLength bounds the length of a stored target URL
+const maxLinkTargetLength = 2048
+
+// linkTokenHeader carries the edit token of PUT /links/:code
+const linkTokenHeader = "X-Link-Token"
+
+// link is a stored redirect behind a dynamic code. The target can change after the
+// code is printed, by whoever holds the edit token returned when it was created, and
+// every redirect counts as a scan.
+type link struct {
+	Code      string    `json:"code"`
+	Target    string    `json:"target"`
+	Scans     int64     `json:"scans"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	TokenHash string    `json:"token_hash"` // hex SHA-256 of the edit token, which is not stored
+}
+
+// linkRequest is the body of POST /links and PUT /links/:code
+type linkRequest struct {
+	Target string `json:"target"`
+}
+
+// linkMu serializes updates to stored links, so concurrent scans are not lost. Instances
+// sharing a file store each count separately, and may overwrite each other's increments.
+var linkMu sync.Mutex
+
+// linkCreates counts the links each client IP creates, against config.LinkCreateLimit
+var linkCreates = newWindowLimiter(time.Hour)
+
+// linkKey namespaces link codes inside the shared store
+func linkKey(code string) string {
+	return "link:" + code
+}
+
+// newLinkCode returns a random short code
+func newLinkCode() (string, error) {
+	code := make([]byte, 0, linkCodeLength)
+	buf := make([]byte, 2*linkCodeLength)
+	for len(code) < linkCodeLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// Rejecting the top of the byte range keeps every character equally likely
+			if int(b) < 256/len(linkCodeAlphabet)*len(linkCodeAlphabet) && len(code) < linkCodeLength {
+				code = append(code, linkCodeAlphabet[int(b)%len(linkCodeAlphabet)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// checkLinkToken fails unless the request carries the link's edit token. Links stored
+// before edit tokens existed have none and cannot be edited.
+func checkLinkToken(c *fiber.Ctx, l link) error {
+	return checkEditToken(c, linkTokenHeader, l.TokenHash, "link")
+}
+
+// loadLink returns the stored link for a code
+func loadLink(code string) (link, error) {
+	var l link
+	value, err := store.Get(linkKey(code))
+	if errors.Is(err, errNotFound) {
+		return l, fiber.NewError(404, "Link not found")
+	}
+	if err != nil {
+		return l, fiber.NewError(500, "Failed to load link")
+	}
+	if err := json.Unmarshal(value, &l); err != nil {
+		return l, fiber.NewError(500, "Failed to load link")
+	}
+	return l, nil
+}
+
+// saveLink stores the link under its code
+func saveLink(l link) error {
+	value, err := json.Marshal(l)
+	if err == nil {
+		err = store.Save(linkKey(l.Code), value)
+	}
+	if err != nil {
+		return storeFailure(err, "Failed to save link")
+	}
+	return nil
+}
+
+// decodeLinkTarget reads and checks the target URL of a link request
+func decodeLinkTarget(c *fiber.Ctx) (string, error) {
+	var req linkRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return "", fiber.NewError(400, "Body must be a JSON link request")
+	}
+	if len(req.Target) > maxLinkTargetLength {
+		return "", fiber.NewError(400, "target must be at most 2048 bytes")
+	}
+	if err := checkLinkTarget(req.Target); err != nil {
+		return "", err
+	}
+	return req.Target, nil
+}
+
+// checkLinkTarget checks that a target URL uses one of the configured schemes and, when
+// hosts are configured, points at one of them or a subdomain
+func checkLinkTarget(target string) error {
+	schemes := config.LinkSchemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" || !slices.ContainsFunc(schemes, func(s string) bool { return strings.EqualFold(s, u.Scheme) }) {
+		return fiber.NewError(400, fmt.Sprintf("target must be an %s URL", strings.Join(schemes, " or ")))
+	}
+	if len(config.LinkHosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	allowed := slices.ContainsFunc(config.LinkHosts, func(h string) bool {
+		h = strings.ToLower(h)
+		return host == h || strings.HasSuffix(host, "."+h)
+	})
+	if !allowed {
+		return fiber.NewError(400, fmt.Sprintf("target host %s is not allowed, use one of %s", host, strings.Join(config.LinkHosts, ", ")))
+	}
+	return nil
+}
+
+// redirectURL returns the public URL that redirects to the link's target
+func redirectURL(c *fiber.Ctx, code string) string {
+	base := config.PublicURL
+	if base == "" {
+		base = c.BaseURL()
+	}
+	return strings.TrimSuffix(base, "/") + "/r/" + code
+}
+
+// linkResponse describes a link with the URLs clients need to use it
+func linkResponse(c *fiber.Ctx, l link) fiber.Map {
+	return fiber.Map{
+		"code":    l.Code,
+		"target":  l.Target,
+		"scans":   l.Scans,
+		"created": l.Created,
+		"updated": l.Updated,
+		"url":     redirectURL(c, l.Code),
+		"qr":      "/links/" + l.Code + "/qr",
+	}
+}
+
+// handleCreateLink serves POST /links, storing a target URL under a new short code. The
+// response carries the link's edit token, which is shown only this once. Each client IP
+// may create config.LinkCreateLimit links an hour.
+func handleCreateLink(c *fiber.Ctx) error {
+	target, err := decodeLinkTarget(c)
+	if err != nil {
+		return err
+	}
+	if ok, wait := linkCreates.allow(c.IP(), config.LinkCreateLimit); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return fiber.NewError(429, "Too many links created from this address, retry later")
+	}
+
+	linkMu.Lock()
+	defer linkMu.Unlock()
+
+	// Codes are random, so a collision is unlikely but must not overwrite another link
+	for range 5 {
+		code, err := newLinkCode()
+		if err != nil {
+			return fiber.NewError(500, "Failed to create link")
+		}
+		if _, err := store.Get(linkKey(code)); !errors.Is(err, errNotFound) {
+			continue
+		}
+		token, hash, err := newEditToken()
+		if err != nil {
+			return fiber.NewError(500, "Failed to create link")
+		}
+		now := time.Now().UTC()
+		l := link{Code: code, Target: target, Created: now, Updated: now, TokenHash: hash}
+		if err := saveLink(l); err != nil {
+			return err
+		}
+		response := linkResponse(c, l)
+		response["edit_token"] = token
+		return c.Status(201).JSON(response)
+	}
+	return fiber.NewError(500, "Failed to create link")
+}
+
+// handleGetLink serves GET /links/:code, reporting the target and scan count
+func handleGetLink(c *fiber.Ctx) error {
+	l, err := loadLink(c.Params("code"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(linkResponse(c, l))
+}
+
+// handleUpdateLink serves PUT /links/:code, pointing an existing code at a new target.
+// The request must carry the edit token in X-Link-Token. The scan count is kept.
+func handleUpdateLink(c *fiber.Ctx) error {
+	target, err := decodeLinkTarget(c)
+	if err != nil {
+		return err
+	}
+
+	linkMu.Lock()
+	defer linkMu.Unlock()
+	l, err := loadLink(c.Params("code"))
+	if err != nil {
+		return err
+	}
+	if err := checkLinkToken(c, l); err != nil {
+		return err
+	}
+	l.Target, l.Updated = target, time.Now().UTC()
+	if err := saveLink(l); err != nil {
+		return err
+	}
+	return c.JSON(linkResponse(c, l))
+}
+
+// handleRedirect serves GET /r/:code, counting a scan and redirecting to the target
+func handleRedirect(c *fiber.Ctx) error {
+	linkMu.Lock()
+	l, err := loadLink(c.Params("code"))
+	if err == nil {
+		l.Scans++
+		err = saveLink(l)
+	}
+	linkMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Every scan must reach the server to be counted and to follow target changes
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Redirect(l.Target, fiber.StatusFound)
+}
+
+// handleLinkQR serves GET /links/:code/qr, rendering a code that points at the link's
+// redirect URL. It takes the same query options as GET /generate, except that data is
+// always the redirect URL.
+func handleLinkQR(c *fiber.Ctx) error {
+	l, err := loadLink(c.Params("code"))
+	if err != nil {
+		return err
+	}
+
+	args := c.Request().URI().QueryArgs()
+	for _, name := range []string{"d", "type", "vars", "data_encoding"} {
+		args.Del(name)
+	}
+	args.Set("data", redirectURL(c, l.Code))
+	return handleGenerate(c)
+}
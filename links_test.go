@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpdateLinkRequiresEditToken(t *testing.T) {
+	previous := store
+	store = newMemoryStore(0)
+	defer func() { store = previous }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Post("/links", handleCreateLink)
+	app.Get("/links/:code", handleGetLink)
+	app.Put("/links/:code", handleUpdateLink)
+	send := func(method, path, token, body string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(linkTokenHeader, token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded map[string]any
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp.StatusCode, decoded
+	}
+
+	status, created := send("POST", "/links", "", `{"target":"https://example.com/a"}`)
+	token, _ := created["edit_token"].(string)
+	if status != 201 || token == "" {
+		t.Fatalf("create: status %d, edit token %q", status, token)
+	}
+	path := "/links/" + created["code"].(string)
+	if _, fetched := send("GET", path, "", ""); fetched["edit_token"] != nil || fetched["token_hash"] != nil {
+		t.Errorf("GET exposes the edit token: %v", fetched)
+	}
+
+	update := `{"target":"https://example.com/b"}`
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{{"", 401}, {"wrong", 403}, {token, 200}} {
+		if status, _ := send("PUT", path, tc.token, update); status != tc.want {
+			t.Errorf("PUT with token %q: status %d, want %d", tc.token, status, tc.want)
+		}
+	}
+	if _, fetched := send("GET", path, "", ""); fetched["target"] != "https://example.com/b" {
+		t.Errorf("target is %v after the update", fetched["target"])
+	}
+}
+
+func TestRedirectCountsScans(t *testing.T) {
+	previous := store
+	store = newMemoryStore(0)
+	defer func() { store = previous }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Post("/links", handleCreateLink)
+	app.Get("/links/:code", handleGetLink)
+	app.Get("/r/:code", handleRedirect)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/links", strings.NewReader(`{"target":"https://example.com/menu"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created map[string]any
+	json.NewDecoder(resp.Body).Decode(&created)
+	code, _ := created["code"].(string)
+	if resp.StatusCode != 201 || code == "" {
+		t.Fatalf("create: status %d, code %q", resp.StatusCode, code)
+	}
+	if url, _ := created["url"].(string); !strings.HasSuffix(url, "/r/"+code) {
+		t.Errorf("url %q does not go through /r/%s", url, code)
+	}
+
+	for range 3 {
+		resp, err := app.Test(httptest.NewRequest("GET", "/r/"+code, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 302 || resp.Header.Get("Location") != "https://example.com/menu" {
+			t.Fatalf("redirect: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+		}
+		if resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("redirect is cacheable: %q", resp.Header.Get("Cache-Control"))
+		}
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/links/"+code, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetched map[string]any
+	json.NewDecoder(resp.Body).Decode(&fetched)
+	if fetched["scans"] != float64(3) {
+		t.Errorf("scans = %v after 3 redirects, want 3", fetched["scans"])
+	}
+
+	if resp, _ := app.Test(httptest.NewRequest("GET", "/r/missing1", nil)); resp.StatusCode != 404 {
+		t.Errorf("unknown code: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestLinkTargetsFollowConfig(t *testing.T) {
+	previous := config
+	defer func() { config = previous }()
+
+	for _, tc := range []struct {
+		schemes, hosts []string
+		target         string
+		ok             bool
+	}{
+		{nil, nil, "https://example.com/a", true},
+		{nil, nil, "http://example.com/a", true},
+		{nil, nil, "javascript:alert(1)", false},
+		{nil, nil, "ftp://example.com/a", false},
+		{nil, nil, "/relative", false},
+		{[]string{"https"}, nil, "http://example.com/a", false},
+		{[]string{"https"}, nil, "HTTPS://example.com/a", true},
+		{nil, []string{"example.com"}, "https://example.com/a", true},
+		{nil, []string{"example.com"}, "https://go.Example.com/a", true},
+		{nil, []string{"example.com"}, "https://badexample.com/a", false},
+		{nil, []string{"example.com"}, "https://example.com.evil.net/a", false},
+	} {
+		config.LinkSchemes, config.LinkHosts = tc.schemes, tc.hosts
+		if err := checkLinkTarget(tc.target); (err == nil) != tc.ok {
+			t.Errorf("schemes %v, hosts %v, target %q: %v", tc.schemes, tc.hosts, tc.target, err)
+		}
+	}
+}
+
+func TestLinkCreationIsRateLimited(t *testing.T) {
+	previousStore, previousConfig, previousCreates := store, config, linkCreates
+	store, linkCreates = newMemoryStore(0), newWindowLimiter(time.Hour)
+	config.LinkCreateLimit = 2
+	defer func() { store, config, linkCreates = previousStore, previousConfig, previousCreates }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Post("/links", handleCreateLink)
+	for i, want := range []int{201, 201, 429} {
+		resp, err := app.Test(httptest.NewRequest("POST", "/links", strings.NewReader(`{"target":"https://example.com/"}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("link %d: status %d, want %d", i+1, resp.StatusCode, want)
+		}
+		if want == 429 && resp.Header.Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+// errLogoFetchBusy is returned when no logo download slot frees up in time
+var errLogoFetchBusy = errors.New("too many concurrent logo downloads")
+
+// logoFetchTimeout bounds a whole download, body included, so a host trickling bytes
+// cannot hold a download slot indefinitely
+const logoFetchTimeout = 15 * time.Second
+
+// logoFetchSlots is a global semaphore bounding the number of logo downloads in flight
+var logoFetchSlots = make(chan struct{}, 8)
+
+// initLogoFetchLimiter sizes the logo download semaphore from the configuration
+func initLogoFetchLimiter(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	logoFetchSlots = make(chan struct{}, concurrency)
+}
+
+// acquireLogoFetchSlot waits up to the configured time for a free download slot.
+// A zero wait fails immediately when the limiter is saturated.
+func acquireLogoFetchSlot(wait time.Duration) error {
+	if wait <= 0 {
+		select {
+		case logoFetchSlots <- struct{}{}:
+			return nil
+		default:
+			return errLogoFetchBusy
+		}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case logoFetchSlots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errLogoFetchBusy
+	}
+}
+
+// fetchFailure maps a failed download of the URL in the named option to the response
+// error, with message describing any other failure
+func fetchFailure(err error, option, message string) error {
+	var tooLarge fetchTooLargeError
+	switch {
+	case errors.Is(err, errLogoFetchBusy):
+		return fiber.NewError(503, "Too many concurrent logo downloads, please retry")
+	case errors.Is(err, errPrivateHost):
+		return fiber.NewError(400, option+" must point to a public host")
+	case errors.As(err, &tooLarge) && tooLarge.pixels > 0:
+		return fiber.NewError(400, fmt.Sprintf("%s must point to an image of at most %d pixels", option, maxFetchedPixels))
+	case errors.As(err, &tooLarge):
+		return fiber.NewError(400, fmt.Sprintf("%s must point to a file of at most %d bytes", option, tooLarge.limit))
+	default:
+		return fiber.NewError(500, message)
+	}
+}
+
+// fetchLogo downloads and decodes a logo image from a public host, holding a download slot for the duration
+func fetchLogo(logoURL string) (image.Image, error) {
+	return fetchImage(publicClient, logoURL)
+}
+
+// fetchImage downloads and decodes a PNG image with the client, holding a download slot for the duration
+func fetchImage(client *http.Client, imageURL string) (image.Image, error) {
+	data, err := fetchBytes(client, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFetchedPNG(data)
+}
+
+// maxFetchedPixels bounds the pixels of a downloaded image, as a few kilobytes of PNG can
+// describe a canvas far larger than any render
+const maxFetchedPixels = 4096 * 4096
+
+// decodeFetchedPNG decodes a downloaded PNG after checking from its header that it has
+// at most maxFetchedPixels
+func decodeFetchedPNG(data []byte) (image.Image, error) {
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxFetchedPixels {
+		return nil, fetchTooLargeError{pixels: cfg.Width * cfg.Height}
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// maxFetchSize bounds the size of a downloaded image or font
+const maxFetchSize = 16 * 1024 * 1024
+
+// fetchTooLargeError is returned for a download longer than its limit in bytes, or an
+// image with more than maxFetchedPixels pixels
+type fetchTooLargeError struct{ limit, pixels int }
+
+func (e fetchTooLargeError) Error() string {
+	if e.pixels > 0 {
+		return fmt.Sprintf("image has %d pixels, above the limit of %d", e.pixels, maxFetchedPixels)
+	}
+	return fmt.Sprintf("file exceeds %d bytes", e.limit)
+}
+
+// fetchBytes downloads a file of at most maxFetchSize bytes with the client, holding a download slot for the duration
+func fetchBytes(client *http.Client, fileURL string) ([]byte, error) {
+	return fetchLimited(client, fileURL, maxFetchSize)
+}
+
+// fetchLimited is fetchBytes for a file of at most limit bytes
+func fetchLimited(client *http.Client, fileURL string, limit int) ([]byte, error) {
+	if err := acquireLogoFetchSlot(config.LogoFetchWait); err != nil {
+		return nil, err
+	}
+	defer func() { <-logoFetchSlots }()
+
+	resp, err := client.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logo host returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err == nil && len(data) > limit {
+		err = fetchTooLargeError{limit: limit}
+	}
+	return data, err
+}
+
+// tintLogo recolors the logo, keeping its own alpha. The "fill" mode paints every pixel the
+// tint color, turning any logo into a flat silhouette. The "multiply" mode scales the tint
+// by each pixel's luminance, so a grayscale logo keeps its shading with white becoming the
+// tint and black staying black; a full-color logo loses its hues and keeps only its shading.
+func tintLogo(logo image.Image, tint color.Color, mode string) *image.NRGBA {
+	bounds := logo.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	t := color.NRGBAModel.Convert(tint).(color.NRGBA)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			p := color.NRGBAModel.Convert(logo.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			a := uint8(uint32(p.A) * uint32(t.A) / 0xff)
+			if mode != "multiply" {
+				result.SetNRGBA(x, y, color.NRGBA{R: t.R, G: t.G, B: t.B, A: a})
+				continue
+			}
+			// Rec. 601 luma on the gamma-encoded values keeps mid grays looking mid gray
+			l := (0.299*float64(p.R) + 0.587*float64(p.G) + 0.114*float64(p.B)) / 255
+			result.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(float64(t.R) * l), G: uint8(float64(t.G) * l), B: uint8(float64(t.B) * l), A: a,
+			})
+		}
+	}
+
+	return result
+}
+
+// blendLogo overlays the color on the logo at the given strength, keeping the logo's own alpha
+func blendLogo(logo *image.NRGBA, c color.Color, strength float64) {
+	bounds := logo.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := logo.NRGBAAt(x, y)
+			mixed := mixColors(color.RGBA{R: p.R, G: p.G, B: p.B, A: 255}, c, strength)
+			logo.SetNRGBA(x, y, color.NRGBA{R: mixed.R, G: mixed.G, B: mixed.B, A: p.A})
+		}
+	}
+}
+
+// logoStyle controls how a fetched logo is composited over the code
+type logoStyle struct {
+	sizePercent  float64     // logo box size as a percentage of the QR size
+	tint         color.Color // recolors the logo when set
+	tintMode     string      // "fill" or "multiply"
+	plate        string      // backing plate: "", "box" or "silhouette"
+	platePadding int         // plate margin around the logo in pixels
+	plateColor   color.Color
+	plateClear   bool        // cut the plate out to transparency instead of filling it
+	blend        float64     // 0..1 strength of the overlay tinting the logo towards blendColor
+	blendColor   color.Color // background or gradient color sampled at the center of the code
+}
+
+// logoBudgetShare is the share of the recoverable codewords an autofitted logo may cover,
+// leaving the rest of the error correction for print defects and scanning noise
+const logoBudgetShare = 0.7
+
+// autofitLogoSize returns the largest logo_size, as a percentage of the image, whose logo box
+// and plate padding hide no more modules than the error correction budget can restore
+func autofitLogoSize(qr *qrcode.QRCode, level qrcode.RecoveryLevel, options QRCodeOptions) float64 {
+	// Each hidden codeword costs 8 modules, so the budget is a square of that many modules
+	budget := float64(recoverableCodewords(level, qr.VersionNumber)*8) * logoBudgetShare
+	_, size := borderPixels(qr, options)
+	modules := float64(len(qr.Bitmap()) + 2*options.Border)
+
+	side := math.Sqrt(budget) * float64(size) / modules
+	if options.LogoPlate != "" {
+		side -= 2 * float64(options.LogoPadding)
+	}
+	return math.Max(0, math.Floor(side*1000/float64(size))/10)
+}
+
+// maxLogoSide bounds the box a logo is scaled into, the largest size a code renders at,
+// so no request can make a logo allocate more than the code it sits on
+const maxLogoSide = 4096
+
+// fitLogo scales the logo up or down to the largest size fitting in w x h, keeping its aspect ratio
+func fitLogo(logo image.Image, w, h int) *image.NRGBA {
+	w, h = min(w, maxLogoSide), min(h, maxLogoSide)
+	size := logo.Bounds().Size()
+	scale := math.Min(float64(w)/float64(size.X), float64(h)/float64(size.Y))
+	width := max(1, int(float64(size.X)*scale))
+	height := max(1, int(float64(size.Y)*scale))
+	return imaging.Resize(logo, width, height, imaging.Lanczos)
+}
+
+// opaqueBounds returns the bounding box of the logo pixels that are not fully transparent
+func opaqueBounds(logo image.Image) image.Rectangle {
+	bounds := logo.Bounds()
+	found := image.Rectangle{Min: bounds.Max, Max: bounds.Min}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := logo.At(x, y).RGBA(); a > 0 {
+				found = found.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return found
+}
+
+// silhouetteMask returns the logo's alpha dilated by padding pixels, so the plate follows the
+// logo outline. A pixel is covered when it lies within padding of a mostly opaque logo pixel,
+// found with a squared Euclidean distance transform in time linear in the mask size.
+func silhouetteMask(logo image.Image, padding int) *image.Alpha {
+	bounds := logo.Bounds()
+	w, h := bounds.Dx()+2*padding, bounds.Dy()+2*padding
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+
+	// Squared distance to the nearest mostly opaque pixel, starting at 0 on them and infinity elsewhere
+	dist := make([]float64, w*h)
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if _, _, _, a := logo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); a >= 0x8000 {
+				dist[(y+padding)*w+x+padding] = 0
+			}
+		}
+	}
+
+	// The transform is separable: columns first, then rows of the column results
+	line := make([]float64, max(w, h))
+	out := make([]float64, max(w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			line[y] = dist[y*w+x]
+		}
+		distanceTransform(line[:h], out[:h])
+		for y := 0; y < h; y++ {
+			dist[y*w+x] = out[y]
+		}
+	}
+	limit := float64(padding * padding)
+	for y := 0; y < h; y++ {
+		distanceTransform(dist[y*w:(y+1)*w], out[:w])
+		for x := 0; x < w; x++ {
+			if out[x] <= limit {
+				mask.Pix[y*mask.Stride+x] = 255
+			}
+		}
+	}
+
+	return mask
+}
+
+// distanceTransform writes to d the squared distance transform of the sampled function f:
+// d[q] is the minimum over p of (q-p)² + f[p]. It computes the lower envelope of the parabolas
+// rooted at each sample (Felzenszwalb and Huttenlocher), skipping samples at infinity.
+func distanceTransform(f, d []float64) {
+	n := len(f)
+	v := make([]int, 0, n)       // samples whose parabolas form the envelope
+	z := make([]float64, 0, n+1) // boundaries between the envelope parabolas
+	for q := 0; q < n; q++ {
+		if math.IsInf(f[q], 1) {
+			continue
+		}
+		fq := f[q] + float64(q*q)
+		for len(v) > 0 {
+			p := v[len(v)-1]
+			s := (fq - f[p] - float64(p*p)) / float64(2*(q-p))
+			if s > z[len(z)-1] {
+				z = append(z, s)
+				break
+			}
+			v, z = v[:len(v)-1], z[:len(z)-1]
+		}
+		if len(v) == 0 {
+			z = append(z, math.Inf(-1))
+		}
+		v = append(v, q)
+	}
+
+	if len(v) == 0 {
+		for q := range d[:n] {
+			d[q] = math.Inf(1)
+		}
+		return
+	}
+	z = append(z, math.Inf(1))
+	k := 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		d[q] = float64((q-v[k])*(q-v[k])) + f[v[k]]
+	}
+}
+
+// embedLogo downloads the logo and draws it centered over the QR code.
+// The logo's own alpha is honored, and an optional backing plate matching
+// either its opaque bounds or its silhouette is drawn underneath it.
+// It also returns the factor the logo was scaled by to fill its box.
+func embedLogo(qrImage image.Image, logoURL string, style logoStyle) (image.Image, float64, error) {
+	// Download logo
+	logoImg, err := fetchLogo(logoURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	sourceWidth := logoImg.Bounds().Dx()
+
+	// Recolor logo
+	if style.tint != nil {
+		logoImg = tintLogo(logoImg, style.tint, style.tintMode)
+	}
+
+	// Calculate logo size
+	qrSize := qrImage.Bounds().Size()
+	logoWidth := int(float64(qrSize.X) * style.sizePercent / 100)
+	logoHeight := int(float64(qrSize.Y) * style.sizePercent / 100)
+
+	// Resize logo
+	fitted := fitLogo(logoImg, logoWidth, logoHeight)
+	if style.blend > 0 {
+		blendLogo(fitted, style.blendColor, style.blend)
+	}
+	logoImg = fitted
+	logoSize := logoImg.Bounds().Size()
+
+	// Create new image with same size as QR code
+	finalImg := image.NewRGBA(qrImage.Bounds())
+
+	// Draw QR code
+	draw.Draw(finalImg, finalImg.Bounds(), qrImage, image.Point{}, draw.Over)
+
+	// Calculate logo position (center)
+	x := (qrSize.X - logoSize.X) / 2
+	y := (qrSize.Y - logoSize.Y) / 2
+	logoPos := image.Rect(x, y, x+logoSize.X, y+logoSize.Y)
+
+	// Draw backing plate, or cut it out
+	plate, op := image.NewUniform(style.plateColor), draw.Over
+	if style.plateClear {
+		plate, op = image.Transparent, draw.Src
+	}
+	switch style.plate {
+	case "box":
+		box := opaqueBounds(logoImg).Add(logoPos.Min).Inset(-style.platePadding)
+		draw.Draw(finalImg, box, plate, image.Point{}, op)
+	case "silhouette":
+		mask := silhouetteMask(logoImg, style.platePadding)
+		platePos := logoPos.Inset(-style.platePadding)
+		draw.DrawMask(finalImg, platePos, plate, image.Point{}, mask, image.Point{}, op)
+	}
+
+	// Draw logo
+	draw.Draw(finalImg, logoPos, logoImg, image.Point{}, draw.Over)
+
+	return finalImg, float64(logoSize.X) / float64(max(sourceWidth, 1)), nil
+}
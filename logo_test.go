@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogoFetchLimiterSaturation(t *testing.T) {
+	initLogoFetchLimiter(2)
+	defer initLogoFetchLimiter(8)
+
+	for i := 0; i < 2; i++ {
+		if err := acquireLogoFetchSlot(0); err != nil {
+			t.Fatalf("slot %d: %v", i, err)
+		}
+	}
+
+	// A full limiter fails fast without a wait, and after the wait with one
+	if err := acquireLogoFetchSlot(0); !errors.Is(err, errLogoFetchBusy) {
+		t.Fatalf("acquire without wait = %v, want errLogoFetchBusy", err)
+	}
+	start := time.Now()
+	if err := acquireLogoFetchSlot(20 * time.Millisecond); !errors.Is(err, errLogoFetchBusy) {
+		t.Fatalf("acquire with wait = %v, want errLogoFetchBusy", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("gave up after %s, before the 20ms wait", waited)
+	}
+
+	// A slot freed while waiting is taken
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-logoFetchSlots
+	}()
+	if err := acquireLogoFetchSlot(time.Second); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+func TestFetchBytesHoldsSlot(t *testing.T) {
+	initLogoFetchLimiter(1)
+	defer initLogoFetchLimiter(8)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("logo"))
+	}))
+	defer server.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := fetchBytes(server.Client(), server.URL)
+		done <- err
+	}()
+	<-started
+
+	// The only slot is held by the download in flight
+	if _, err := fetchBytes(server.Client(), server.URL); !errors.Is(err, errLogoFetchBusy) {
+		t.Fatalf("second fetch = %v, want errLogoFetchBusy", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	if len(logoFetchSlots) != 0 {
+		t.Errorf("%d slots still held after the download finished", len(logoFetchSlots))
+	}
+}
+
+func TestSilhouetteMaskMatchesDiscDilation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	logo := image.NewNRGBA(image.Rect(3, 5, 43, 30))
+	for i := 0; i < 60; i++ {
+		x, y := 3+rng.Intn(40), 5+rng.Intn(25)
+		logo.SetNRGBA(x, y, color.NRGBA{A: uint8(rng.Intn(256))})
+	}
+
+	for _, padding := range []int{0, 1, 4, 9} {
+		mask := silhouetteMask(logo, padding)
+		bounds := logo.Bounds()
+		for y := 0; y < mask.Rect.Dy(); y++ {
+			for x := 0; x < mask.Rect.Dx(); x++ {
+				// Covered when a disc of the padding radius around a mostly opaque pixel reaches it
+				want := false
+				for ly := 0; ly < bounds.Dy() && !want; ly++ {
+					for lx := 0; lx < bounds.Dx() && !want; lx++ {
+						dx, dy := x-padding-lx, y-padding-ly
+						want = logo.NRGBAAt(bounds.Min.X+lx, bounds.Min.Y+ly).A >= 0x80 && dx*dx+dy*dy <= padding*padding
+					}
+				}
+				if got := mask.AlphaAt(x, y).A == 255; got != want {
+					t.Fatalf("padding %d: pixel (%d,%d) covered = %t, want %t", padding, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// serveImage serves img as a PNG for the duration of the test, letting publicClient
+// download from the local test server
+func serveImage(t *testing.T, img image.Image) string {
+	t.Helper()
+	previous := publicClient
+	publicClient = newPublicClient(true, nil, nil)
+	t.Cleanup(func() { publicClient = previous })
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/logo.png"
+}
+
+func TestEnlargedLogoWarnsForPrint(t *testing.T) {
+	small := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(small, small.Bounds(), image.NewUniform(color.NRGBA{R: 200, A: 255}), image.Point{}, draw.Src)
+
+	for _, dpi := range []int{0, 300} {
+		options := testOptions("https://example.com")
+		options.LogoURL = serveImage(t, small)
+		options.Error = "H"
+		options.DPI = dpi
+		if _, err := prepareOptions(&options); err != nil {
+			t.Fatal(err)
+		}
+		_, warnings, err := generateImage(options, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warned := slices.ContainsFunc(warnings, func(w string) bool { return strings.HasPrefix(w, "logo is enlarged") })
+		if warned != (dpi > 0) {
+			t.Errorf("dpi=%d: enlarged logo warning = %t, want %t (%q)", dpi, warned, dpi > 0, warnings)
+		}
+	}
+}
+
+func TestLogoSizeIsBounded(t *testing.T) {
+	options := testOptions("https://example.com")
+	options.LogoURL = "https://example.com/logo.png"
+	options.LogoSize = 2000
+	if _, err := prepareOptions(&options); err == nil {
+		t.Error("logo_size=2000 passed validation")
+	}
+
+	// However large the box, the logo is never scaled past maxLogoSide
+	fitted := fitLogo(image.NewNRGBA(image.Rect(0, 0, 4, 2)), 1<<20, 1<<20)
+	if size := fitted.Bounds().Size(); size.X != maxLogoSide || size.Y != maxLogoSide/2 {
+		t.Errorf("logo fitted to %v, want %dx%d", size, maxLogoSide, maxLogoSide/2)
+	}
+}
+
+func TestSilhouettePlateFollowsLogoAlpha(t *testing.T) {
+	// An opaque red disc on a transparent square
+	logo := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			if dx, dy := x-50, y-50; dx*dx+dy*dy <= 30*30 {
+				logo.SetNRGBA(x, y, color.NRGBA{R: 220, A: 255})
+			}
+		}
+	}
+	plain := testOptions("https://example.com/silhouette")
+	plain.Error = "H"
+	options := plain
+	options.LogoURL = serveImage(t, logo)
+	options.LogoPlate = "silhouette"
+	options.LogoPadding = 4
+	before, img := renderCode(t, plain), renderCode(t, options)
+
+	// At size 300 the logo fills the 60 pixel box centered at (150,150), so the disc has a
+	// radius of 18 and the plate reaches 22
+	rgba := func(img image.Image, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+	if got := rgba(img, 150, 150); got.R < 200 || got.G > 40 {
+		t.Errorf("logo center is %v, want red", got)
+	}
+	// Dark modules two pixels outside the disc are covered by the plate
+	covered := 0
+	for angle := 0.0; angle < 2*math.Pi; angle += math.Pi / 16 {
+		x, y := 150+int(math.Round(20*math.Cos(angle))), 150+int(math.Round(20*math.Sin(angle)))
+		if rgba(before, x, y).R > 128 {
+			continue
+		}
+		covered++
+		if got := rgba(img, x, y); got.G < 240 || got.B < 240 {
+			t.Errorf("dark module at (%d,%d) in the plate margin shows through as %v", x, y, got)
+		}
+	}
+	if covered == 0 {
+		t.Fatal("no dark module around the disc to check the plate against")
+	}
+	// The transparent corners of the logo box keep the modules under them
+	for _, p := range []image.Point{{121, 121}, {178, 121}, {121, 178}, {178, 178}} {
+		if got, want := rgba(img, p.X, p.Y), rgba(before, p.X, p.Y); got != want {
+			t.Errorf("transparent logo corner %v is %v, want the module color %v", p, got, want)
+		}
+	}
+	assertDecodes(t, img, options.Data)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+// applyLogoMask clears the dark modules under the ink of a monochrome mask fitted into a
+// centered box of sizePercent of the symbol, so the logo shows as negative space drawn by
+// the modules themselves. Function patterns are kept. The cleared modules must damage no
+// more codewords than an autofitted logo may, or the mask is rejected.
+func applyLogoMask(bitmap [][]bool, qr *qrcode.QRCode, mask image.Image, sizePercent float64, errorLevel string, quietZone int) error {
+	symbol := len(qr.Bitmap())
+	bounds := mask.Bounds()
+	side := math.Max(1, math.Round(float64(symbol)*sizePercent/100))
+	scale := math.Min(side/float64(bounds.Dx()), side/float64(bounds.Dy()))
+	originX := (float64(symbol) - float64(bounds.Dx())*scale) / 2
+	originY := (float64(symbol) - float64(bounds.Dy())*scale) / 2
+
+	// A mask pixel is ink when it is mostly opaque and dark
+	ink := func(mx, my int) bool {
+		u := int(math.Floor((float64(mx) + 0.5 - originX) / scale))
+		v := int(math.Floor((float64(my) + 0.5 - originY) / scale))
+		if u < 0 || v < 0 || u >= bounds.Dx() || v >= bounds.Dy() {
+			return false
+		}
+		c := mask.At(bounds.Min.X+u, bounds.Min.Y+v)
+		_, _, _, a := c.RGBA()
+		return a >= 0x8000 && overWhite(c) < 0.5
+	}
+
+	damaged := map[int]bool{}
+	for y, row := range codewordIndexes(qr.VersionNumber) {
+		for x, codeword := range row {
+			if codeword < 0 || !bitmap[y+quietZone][x+quietZone] || !ink(x, y) {
+				continue
+			}
+			bitmap[y+quietZone][x+quietZone] = false
+			damaged[codeword] = true
+		}
+	}
+
+	limit := int(float64(recoverableCodewords(getErrorCorrection(errorLevel), qr.VersionNumber)) * logoBudgetShare)
+	if len(damaged) > limit {
+		return fiber.NewError(400, fmt.Sprintf("logo_mask_url clears modules in %d codewords, but error level %s safely restores %d; lower logo_mask_size or raise error",
+			len(damaged), errorLevel, limit))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Lottie animation timing in frames: each module row starts lottieStagger frames after the
+// one above it, fades in over lottieFade frames, and the finished code holds for lottieHold
+const (
+	lottieFrameRate = 30
+	lottieStagger   = 2
+	lottieFade      = 10
+	lottieHold      = 30
+)
+
+// lottieStatic wraps a value as a non-animated Lottie property
+func lottieStatic(value any) map[string]any {
+	return map[string]any{"a": 0, "k": value}
+}
+
+// lottieTransform returns an identity layer transform with the given opacity property
+func lottieTransform(opacity map[string]any) map[string]any {
+	return map[string]any{
+		"o": opacity,
+		"r": lottieStatic(0),
+		"p": lottieStatic([]float64{0, 0, 0}),
+		"a": lottieStatic([]float64{0, 0, 0}),
+		"s": lottieStatic([]float64{100, 100, 100}),
+	}
+}
+
+// lottieColor converts a color to Lottie's normalized RGBA array
+func lottieColor(c color.Color) []float64 {
+	r, g, b, _ := c.RGBA()
+	return []float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff, 1}
+}
+
+// renderLottie renders the code as a Lottie animation with one shape layer per module row,
+// revealed top to bottom by staggered fades over a solid background layer. Only the final
+// frames show the complete code, so players must be paused on, or allowed to reach, the
+// end of the animation before the code can be scanned.
+func renderLottie(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error) {
+	bitmap := moduleMatrix(qr, options.Border)
+	modules := len(bitmap)
+	size := max(options.Size, modules)
+	cell := float64(size) / float64(modules)
+	end := (modules-1)*lottieStagger + lottieFade + lottieHold
+
+	// Layers are listed top first, so the rows precede the background
+	var layers []map[string]any
+	for y, row := range bitmap {
+		var shapes []map[string]any
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			// Merge each run of dark modules into a single rectangle
+			width := float64(x-start) * cell
+			shapes = append(shapes, map[string]any{
+				"ty": "rc",
+				"p":  lottieStatic([]float64{float64(start)*cell + width/2, (float64(y) + 0.5) * cell}),
+				"s":  lottieStatic([]float64{width, cell}),
+				"r":  lottieStatic(0),
+			})
+		}
+		if len(shapes) == 0 {
+			continue
+		}
+		shapes = append(shapes,
+			map[string]any{"ty": "fl", "c": lottieStatic(lottieColor(qr.ForegroundColor)), "o": lottieStatic(100)},
+			map[string]any{
+				"ty": "tr",
+				"p":  lottieStatic([]float64{0, 0}),
+				"a":  lottieStatic([]float64{0, 0}),
+				"s":  lottieStatic([]float64{100, 100}),
+				"r":  lottieStatic(0),
+				"o":  lottieStatic(100),
+			})
+
+		start := y * lottieStagger
+		fade := map[string]any{"a": 1, "k": []map[string]any{
+			{"t": start, "s": []float64{0}, "i": map[string]any{"x": []float64{0.4}, "y": []float64{1}}, "o": map[string]any{"x": []float64{0.6}, "y": []float64{0}}},
+			{"t": start + lottieFade, "s": []float64{100}},
+		}}
+		layers = append(layers, map[string]any{
+			"ddd": 0, "ind": len(layers) + 1, "ty": 4, "nm": fmt.Sprintf("row %d", y),
+			"ks": lottieTransform(fade), "ao": 0, "ip": 0, "op": end, "st": 0, "bm": 0,
+			"shapes": []map[string]any{{"ty": "gr", "nm": "modules", "it": shapes}},
+		})
+	}
+
+	layers = append(layers, map[string]any{
+		"ddd": 0, "ind": len(layers) + 1, "ty": 1, "nm": "background",
+		"sc": hexColor(qr.BackgroundColor), "sw": size, "sh": size,
+		"ks": lottieTransform(lottieStatic(100)), "ao": 0, "ip": 0, "op": end, "st": 0, "bm": 0,
+	})
+
+	return json.Marshal(map[string]any{
+		"v": "5.7.4", "nm": "QR code", "ddd": 0,
+		"fr": lottieFrameRate, "ip": 0, "op": end,
+		"w": size, "h": size,
+		"assets": []any{}, "layers": layers,
+	})
+}
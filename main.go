@@ -1,63 +1,210 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
-	"image/png"
 	"log"
 	"math"
-	"net/http"
 	"strings"
 
-	"github.com/disintegration/imaging"
 	"github.com/gofiber/fiber/v2"
 	"github.com/skip2/go-qrcode"
 )
 
-// QRCodeOptions represents the customization parameters for QR code generation
+// config is the server configuration loaded at startup
+var config Config
+
+// store holds presets and other persisted state
+var store Store
+
+// QRCodeOptions represents the customization parameters for QR code generation. Fields
+// tagged fetch:"url" hold URLs the service downloads from.
 type QRCodeOptions struct {
-	Data          string  `json:"data"`
-	Size          int     `json:"size"`
-	Foreground    string  `json:"foreground"`
-	Background    string  `json:"background"`
-	Error         string  `json:"error"`
-	Border        int     `json:"border"`
-	LogoURL       string  `json:"logo_url"`
-	LogoSize      float64 `json:"logo_size"` // percentage of QR size
-	GradientStart string  `json:"gradient_start"`
-	GradientEnd   string  `json:"gradient_end"`
-	GradientType  string  `json:"gradient_type"` // "linear", "radial"
+	Preset       string `json:"-"` // name of stored options used as defaults
+	Data         string `json:"data"`
+	Type         string `json:"type"`          // "crypto" builds data from the typed fields below
+	AutoType     bool   `json:"auto_type"`     // detects the kind of data, reporting it and checking its conventions
+	Vars         string `json:"vars"`          // JSON object substituted into {{name}} placeholders in data
+	DataEncoding string `json:"data_encoding"` // "text" or "base64"; base64 data is decoded to raw bytes
+	Size         int    `json:"size"`
+	Foreground   string `json:"foreground"`
+	Background   string `json:"background"`
+	Error        string `json:"error"`
+	EncodingMode string `json:"encoding_mode"` // "numeric", "alphanumeric", "byte", "auto"; data must fit the declared mode
+	Border       int    `json:"border"`        // quiet zone in modules; 0 removes it, which many scanners cannot read
+
+	FrameStyle string `json:"frame_style"` // "dotted", "dashed"; drawn inside the quiet zone
+	FrameColor string `json:"frame_color"`
+	FrameDash  int    `json:"frame_dash"` // dash length and dot spacing in pixels
+
+	BorderRadius int `json:"border_radius"` // rounds the image corners in pixels, clamped to stay within the quiet zone
+
+	BorderTop         int    `json:"border_top"` // per-side quiet zone in modules, -1 uses border
+	BorderRight       int    `json:"border_right"`
+	BorderBottom      int    `json:"border_bottom"`
+	BorderLeft        int    `json:"border_left"`
+	BorderTopColor    string `json:"border_top_color"` // per-side fill, defaults to the background
+	BorderRightColor  string `json:"border_right_color"`
+	BorderBottomColor string `json:"border_bottom_color"`
+	BorderLeftColor   string `json:"border_left_color"`
+
+	Bleed      int    `json:"bleed"` // print margin in pixels added outside the finished image
+	BleedColor string `json:"bleed_color"`
+
+	LogoURL              string  `json:"logo_url" fetch:"url"`
+	LogoSize             float64 `json:"logo_size"`      // percentage of QR size
+	LogoTint             string  `json:"logo_tint"`      // recolors the logo to this color, keeping its alpha
+	LogoTintMode         string  `json:"logo_tint_mode"` // "fill" paints the tint flat, "multiply" scales it by the logo's luminance
+	LogoPlate            string  `json:"logo_plate"`     // "box", "silhouette"; background-colored plate behind the logo
+	LogoPadding          int     `json:"logo_padding"`
+	LogoPlateTransparent bool    `json:"logo_plate_transparent"` // cuts the plate out of the code, so the design beneath shows through
+	LogoAutofit          bool    `json:"logo_autofit"`           // sizes the logo to the largest the error correction can recover
+	LogoBlend            float64 `json:"logo_blend"`             // 0..1, tints the logo towards the color behind the center of the code
+	GradientStart        string  `json:"gradient_start"`
+	GradientEnd          string  `json:"gradient_end"`
+	GradientType         string  `json:"gradient_type"` // "linear", "radial"
+
+	GradientAngle float64 `json:"gradient_angle"` // linear gradient direction in degrees, clockwise from left to right
+	GradientFrom  string  `json:"gradient_from"`  // "x,y" start of the linear gradient vector, normalized 0-1; with gradient_to overrides the angle
+	GradientTo    string  `json:"gradient_to"`
+
+	GradientFallback string `json:"gradient_fallback"` // solid foreground used when the gradient is incomplete
+
+	GradientAutoContrast bool `json:"gradient_autocontrast"` // darken gradient stops that are too close to the background
+
+	Safe      bool `json:"safe"`       // enables every scannability guard, see applySafeMode, answering 422 when one fails
+	PrintSafe bool `json:"print_safe"` // pulls colors outside the CMYK print gamut in to printable ones
+
+	Seed    int64  `json:"seed"`    // drives deterministic style randomization
+	Palette string `json:"palette"` // semicolon separated module colors picked per module by seed
+
+	ModuleJitter  float64 `json:"module_jitter"`  // 0..1, varies data module size and position by seed
+	ModuleGap     float64 `json:"module_gap"`     // percent of a module left clear around each dark module
+	ModuleQuality string  `json:"module_quality"` // "fast", "balanced", "best"; smooths jittered or gapped module edges
+
+	ModuleImageURL string `json:"module_image_url" fetch:"url"` // PNG tile stamped on every dark module outside the finder patterns
+
+	SplitColors string  `json:"split_colors"` // two semicolon separated module colors, one per side of a line through the center
+	SplitAngle  float64 `json:"split_angle"`  // split line direction in degrees, clockwise from horizontal
+
+	LogoMaskURL  string  `json:"logo_mask_url" fetch:"url"` // monochrome PNG whose ink clears the modules under it, showing the logo as negative space
+	LogoMaskSize float64 `json:"logo_mask_size"`            // mask box as a percentage of the symbol
+
+	EyeImageURL   string `json:"eye_image_url" fetch:"url"` // image replacing the center of each finder pattern
+	EyeOuterShape string `json:"eye_outer_shape"`           // "square", "rounded", "circle" for the 7x7 ring of each finder pattern
+	EyeInnerShape string `json:"eye_inner_shape"`           // same choices, for the 3x3 center
+	EyeOuterColor string `json:"eye_outer_color"`           // defaults to the module color
+	EyeInnerColor string `json:"eye_inner_color"`           // defaults to the module color
+
+	BackgroundImageURL string `json:"background_image_url" fetch:"url"` // photo shown through the light areas
+	BackgroundFit      string `json:"background_fit"`                   // "cover", "contain", "stretch"
+	BackgroundAlign    string `json:"background_align"`                 // anchor for cropping or placing the photo, e.g. "top-left"
+
+	BackgroundPattern string `json:"background_pattern"` // "dots", "grid", "stripes"
+	PatternColor      string `json:"pattern_color"`
+
+	Vignette      bool   `json:"vignette"` // shades the background towards the edges
+	VignetteColor string `json:"vignette_color"`
+
+	Currency      string `json:"currency"` // type=crypto: bitcoin, ethereum, ...
+	Address       string `json:"address"`
+	Amount        string `json:"amount"`
+	CryptoLabel   string `json:"crypto_label"`
+	CryptoMessage string `json:"crypto_message"`
+
+	Shape       string `json:"shape"`        // "circle", "rounded"; clips the whole image
+	ImageRadius int    `json:"image_radius"` // rounds the corners of the final image, in pixels
+
+	Layout            string `json:"layout"`      // "circular" centers the square code in a round frame
+	LayoutFill        string `json:"layout_fill"` // "background", "modules"; what fills the frame around the code
+	LayoutBorder      int    `json:"layout_border"`
+	LayoutBorderColor string `json:"layout_border_color"` // defaults to the foreground color
+
+	RingPercent   float64 `json:"ring_percent"` // progress arc drawn around the code, 0 disables it
+	RingColor     string  `json:"ring_color"`
+	RingThickness int     `json:"ring_thickness"`
+
+	Card        bool   `json:"card"`
+	CardRadius  int    `json:"card_radius"`
+	CardColor   string `json:"card_color"`
+	CardPadding int    `json:"card_padding"`
+
+	Label      string  `json:"label"`       // text drawn centered below the code
+	LabelColor string  `json:"label_color"` // defaults to the foreground color
+	LabelSize  float64 `json:"label_size"`  // font size in pixels
+	LabelDir   string  `json:"label_dir"`   // "auto", "ltr", "rtl"; auto follows the first strong character
+
+	CaptionFont    string `json:"caption_font"`                 // bundled typeface of the label, e.g. "go-bold"
+	CaptionFontURL string `json:"caption_font_url" fetch:"url"` // TrueType or OpenType font for the label, replacing caption_font
+
+	ShowText    bool `json:"show_text"`     // prints the encoded data in monospace below the code
+	ShowTextMax int  `json:"show_text_max"` // characters shown before the data is cut with an ellipsis
+
+	SVGLink bool `json:"svg_link"` // wraps SVG output in a link to data when it is a URL
+
+	ECOverlay bool `json:"ec_overlay"` // with debug=true, tints data modules blue and error correction modules orange
+
+	Format   string `json:"format"`    // "png", "jpeg", "ico", "html", "svg", "ansi", "css", "json-matrix", "lottie", "gocode"
+	Sizes    string `json:"sizes"`     // icon sizes for "ico", e.g. "16,32,48,64"
+	CellSize int    `json:"cell_size"` // module size in pixels for "html" and "css"
+	Quality  int    `json:"quality"`   // JPEG quality, 1-100; color is always stored at half resolution (4:2:0)
+	MaxBytes int    `json:"max_bytes"` // output size budget; lowers JPEG quality, then downscales, until it fits
+
+	Orientation int `json:"orientation"` // EXIF orientation 1-8 written into JPEG output, 0 writes no EXIF
+
+	TraceID string `json:"trace_id"` // ID hidden in the pixel bits above the code, read back by POST /trace
+
+	DPI         int     `json:"dpi"`           // print resolution the size is meant for, also tagged into PNG output; 0 when not printing
+	MinModuleMM float64 `json:"min_module_mm"` // narrowest printed module allowed with dpi
+
+	GoPackage string `json:"go_package"` // package clause of "gocode" output
+	GoVar     string `json:"go_var"`     // name of the byte slice declared by "gocode" output
+
+	noWatermark bool // set for requests exempt from the configured attribution mark
+	version     int  // symbol version forced on every code of a batch, 0 lets the data decide
+
+	captionFace  *captionFace // downloaded caption_font_url, once resolveCaptionFont loaded it
+	modulePixels float64      // rendered module width, once checkPrintSize measured it for dpi
 }
 
-// parseColor converts a color string to color.Color
+// parseColor converts a color string to color.Color, falling back to black
 func parseColor(colorStr string) color.Color {
+	c, ok := lookupColor(colorStr)
+	if !ok {
+		return color.Black
+	}
+	return c
+}
+
+// lookupColor converts a color string to color.Color, reporting whether it was recognized
+func lookupColor(colorStr string) (color.Color, bool) {
 	// Handle RGB/RGBA format
 	var r, g, b, a uint8 = 0, 0, 0, 255
 
 	if n, err := fmt.Sscanf(colorStr, "rgb(%d,%d,%d)", &r, &g, &b); err == nil && n == 3 {
-		return color.RGBA{R: r, G: g, B: b, A: a}
+		return color.RGBA{R: r, G: g, B: b, A: a}, true
 	}
 	if n, err := fmt.Sscanf(colorStr, "rgba(%d,%d,%d,%d)", &r, &g, &b, &a); err == nil && n == 4 {
-		return color.RGBA{R: r, G: g, B: b, A: a}
+		// The channels are given unpremultiplied
+		return color.NRGBA{R: r, G: g, B: b, A: a}, true
 	}
 
 	// Handle basic named colors as fallback
 	switch strings.ToLower(colorStr) {
 	case "black":
-		return color.Black
+		return color.Black, true
 	case "white":
-		return color.White
+		return color.White, true
 	case "red":
-		return color.RGBA{R: 255, A: 255}
+		return color.RGBA{R: 255, A: 255}, true
 	case "green":
-		return color.RGBA{G: 255, A: 255}
+		return color.RGBA{G: 255, A: 255}, true
 	case "blue":
-		return color.RGBA{B: 255, A: 255}
+		return color.RGBA{B: 255, A: 255}, true
 	default:
-		return color.Black
+		return nil, false
 	}
 }
 
@@ -77,47 +224,9 @@ func getErrorCorrection(level string) qrcode.RecoveryLevel {
 	}
 }
 
-// You'll need to add logo embedding logic after QR generation
-func embedLogo(qrImage image.Image, logoURL string, sizePercent float64) (image.Image, error) {
-	// Download logo
-	resp, err := http.Get(logoURL)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Read logo image
-	logoImg, err := png.Decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// Calculate logo size
-	qrSize := qrImage.Bounds().Size()
-	logoWidth := int(float64(qrSize.X) * sizePercent / 100)
-	logoHeight := int(float64(qrSize.Y) * sizePercent / 100)
-
-	// Resize logo
-	logoImg = imaging.Fit(logoImg, logoWidth, logoHeight, imaging.Lanczos)
-
-	// Create new image with same size as QR code
-	finalImg := image.NewRGBA(qrImage.Bounds())
-
-	// Draw QR code
-	draw.Draw(finalImg, finalImg.Bounds(), qrImage, image.Point{}, draw.Over)
-
-	// Calculate logo position (center)
-	x := (qrSize.X - logoWidth) / 2
-	y := (qrSize.Y - logoHeight) / 2
-	logoPos := image.Rect(x, y, x+logoWidth, y+logoHeight)
-
-	// Draw logo
-	draw.Draw(finalImg, logoPos, logoImg, image.Point{}, draw.Over)
-
-	return finalImg, nil
-}
-
-func createGradient(width, height int, startColor, endColor color.Color, gradientType string) *image.RGBA {
+// createGradient fills an image with a gradient. Linear gradients run along the
+// vector; radial gradients spread from the center.
+func createGradient(width, height int, startColor, endColor color.Color, gradientType string, vector gradientVector) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 
 	// Convert colors to RGBA for easier manipulation
@@ -128,20 +237,25 @@ func createGradient(width, height int, startColor, endColor color.Color, gradien
 	startR, startG, startB = startR>>8, startG>>8, startB>>8
 	endR, endG, endB = endR>>8, endG>>8, endB>>8
 
+	// Project pixels, in coordinates normalized to the image, onto the gradient vector
+	linearRatio := func(x, y int) float64 {
+		return vector.ratio(float64(x)/float64(max(width-1, 1)), float64(y)/float64(max(height-1, 1)))
+	}
+
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
 			var ratio float64
 
 			switch gradientType {
 			case "linear":
-				ratio = float64(x) / float64(width-1)
+				ratio = linearRatio(x, y)
 			case "radial":
 				centerX, centerY := float64(width)/2, float64(height)/2
 				distance := math.Sqrt(math.Pow(float64(x)-centerX, 2) + math.Pow(float64(y)-centerY, 2))
 				maxDistance := math.Sqrt(math.Pow(centerX, 2) + math.Pow(centerY, 2))
 				ratio = math.Min(distance/maxDistance, 1.0)
 			default:
-				ratio = float64(x) / float64(width-1)
+				ratio = linearRatio(x, y)
 			}
 
 			r := uint8(float64(startR) + ratio*float64(int(endR)-int(startR)))
@@ -156,114 +270,87 @@ func createGradient(width, height int, startColor, endColor color.Color, gradien
 }
 
 func main() {
-	app := fiber.New()
-
-	app.Get("/generate", func(c *fiber.Ctx) error {
-		options := QRCodeOptions{
-			Data:          c.Query("data", ""),
-			Size:          c.QueryInt("size", 300),
-			Foreground:    c.Query("foreground", "black"),
-			Background:    c.Query("background", "white"),
-			Error:         c.Query("error", "M"),
-			Border:        c.QueryInt("border", 4),
-			LogoURL:       c.Query("logo_url", ""),
-			LogoSize:      c.QueryFloat("logo_size", 20.0),
-			GradientStart: c.Query("gradient_start", ""),
-			GradientEnd:   c.Query("gradient_end", ""),
-			GradientType:  c.Query("gradient_type", "linear"),
-		}
-
-		// Validation
-		if options.Data == "" {
-			return c.Status(400).JSON(fiber.Map{"error": "Data parameter is required"})
-		}
-
-		// Validation
-		if options.Border < 0 {
-			options.Border = 0
-		}
-
-		// Generate base QR code
-		qr, err := qrcode.New(options.Data, getErrorCorrection(options.Error))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate QR code"})
-		}
-
-		// Set QR code properties
-		qr.ForegroundColor = parseColor(options.Foreground)
-		qr.BackgroundColor = parseColor(options.Background)
-
-		// Handle border
-		if options.Border == 0 {
-			qr.DisableBorder = true
-		} else {
-			qr.DisableBorder = false
-			// The QR code library uses 4 as the default border size
-			// We might need to add padding manually if we want a larger border
-			extraPadding := options.Border - 4
-			if extraPadding > 0 {
-				options.Size += (extraPadding * 2) // Increase size to accommodate extra padding
-			}
-		}
+	config = loadConfig()
+	initLogoFetchLimiter(config.LogoFetchConcurrency)
+	if err := initPublicClient(config.AllowPrivateFetch, config.LogoProxy, config.LogoCABundle); err != nil {
+		log.Fatalf("failed to configure the download client: %v", err)
+	}
+	initBatchWorkers(config.BatchWorkers)
+	applyGradientDefaults(config)
+	if err := loadFonts(); err != nil {
+		log.Fatalf("failed to load bundled assets: %v", err)
+	}
 
-		// Generate initial image
-		var buf bytes.Buffer
-		if err := qr.Write(options.Size, &buf); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate image"})
-		}
+	var err error
+	if store, err = newStore(config); err != nil {
+		log.Fatalf("failed to open %s store: %v", config.StoreBackend, err)
+	}
+	if cache, err = newCache(config); err != nil {
+		log.Fatalf("failed to open %s cache: %v", config.CacheBackend, err)
+	}
 
-		// Decode the generated image
-		img, err := png.Decode(bytes.NewReader(buf.Bytes()))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to process image"})
-		}
+	app := fiber.New(fiber.Config{
+		ErrorHandler: errorHandler,
+		BodyLimit:    config.MaxBodySize,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	})
+	log.Printf("timeouts: read %s, write %s, idle %s", config.ReadTimeout, config.WriteTimeout, config.IdleTimeout)
+	log.Printf("gradient defaults: type %s, angle %g", defaultOptions.GradientType, defaultOptions.GradientAngle)
 
-		// Apply gradient if specified
-		if options.GradientStart != "" && options.GradientEnd != "" {
-			startColor := parseColor(options.GradientStart)
-			endColor := parseColor(options.GradientEnd)
-			gradient := createGradient(img.Bounds().Dx(), img.Bounds().Dy(), startColor, endColor, options.GradientType)
-
-			// Create a new RGBA image for the result
-			finalImg := image.NewRGBA(img.Bounds())
-
-			// Draw the gradient first
-			draw.Draw(finalImg, finalImg.Bounds(), gradient, image.Point{}, draw.Src)
-
-			// Draw the QR code on top, but only where it's the foreground color
-			for y := 0; y < img.Bounds().Dy(); y++ {
-				for x := 0; x < img.Bounds().Dx(); x++ {
-					r, g, b, _ := img.At(x, y).RGBA()
-					// Check if the pixel matches the foreground color
-					fr, fg, fb, _ := qr.ForegroundColor.RGBA()
-					if r == fr && g == fg && b == fb {
-						finalImg.Set(x, y, gradient.At(x, y))
-					} else {
-						finalImg.Set(x, y, qr.BackgroundColor)
-					}
-				}
-			}
+	app.Get("/generate", handleGenerate)
+	for ext := range extensionFormats {
+		app.Get("/generate."+ext, handleGenerate)
+	}
+	app.Post("/generate/sprite", bodyLimit(maxSpriteBodySize), handleSprite)
+	app.Post("/generate/sheet", bodyLimit(maxSpriteBodySize), handleSheet)
+	app.Post("/generate/grid", bodyLimit(maxSpriteBodySize), handleGrid)
+	app.Post("/validate", bodyLimit(maxPresetBodySize), handleValidate)
+	app.Post("/trace", bodyLimit(maxFetchSize), handleTrace)
+	app.Get("/capacity", handleCapacity)
+	app.Get("/schema", handleSchema)
+
+	app.Put("/presets/:name", bodyLimit(maxPresetBodySize), handleSavePreset)
+	app.Get("/presets/:name", handleGetPreset)
+	app.Delete("/presets/:name", handleDeletePreset)
+
+	app.Post("/links", bodyLimit(maxPresetBodySize), handleCreateLink)
+	app.Get("/links/:code", handleGetLink)
+	app.Put("/links/:code", bodyLimit(maxPresetBodySize), handleUpdateLink)
+	app.Get("/links/:code/qr", handleLinkQR)
+	app.Get("/r/:code", handleRedirect)
 
-			img = finalImg
-		}
+	log.Fatal(app.Listen(":3007"))
+}
 
-		// Embed logo if specified
-		if options.LogoURL != "" {
-			img, err = embedLogo(img, options.LogoURL, options.LogoSize)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": "Failed to embed logo"})
-			}
+// bodyLimit rejects requests whose body is larger than max bytes with 413 Payload Too Large.
+// The server-wide MaxBodySize still applies first, so per-route limits must not exceed it.
+func bodyLimit(max int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Request().Header.ContentLength() > max || len(c.Body()) > max {
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds the %d byte limit", max))
 		}
+		return c.Next()
+	}
+}
 
-		// Encode final image
-		var finalBuf bytes.Buffer
-		if err := png.Encode(&finalBuf, img); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to encode final image"})
-		}
+// errorHandler renders errors returned by handlers as JSON bodies holding a stable error
+// code and the message in the language the client asked for
+func errorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	message := "Internal server error"
 
-		c.Set("Content-Type", "image/png")
-		return c.Send(finalBuf.Bytes())
-	})
+	var e *fiber.Error
+	if errors.As(err, &e) {
+		code = e.Code
+		message = e.Message
+	}
+	if code == fiber.StatusRequestEntityTooLarge && e == fiber.ErrRequestEntityTooLarge {
+		message = fmt.Sprintf("Request body exceeds the %d byte limit", config.MaxBodySize)
+	}
 
-	log.Fatal(app.Listen(":3007"))
+	errorCode, message := localizeError(code, message, requestLanguage(c))
+	c.Vary(fiber.HeaderAcceptLanguage)
+	return c.Status(code).JSON(fiber.Map{"error": message, "code": errorCode})
 }
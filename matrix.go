@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// matrixFormat renders an output format straight from the module matrix, without rasterizing
+type matrixFormat struct {
+	contentType string
+	render      func(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error)
+}
+
+// matrixFormats lists the output formats built from the module matrix.
+// Raster decorations such as gradients and logos do not apply to them.
+var matrixFormats = map[string]matrixFormat{
+	"html": {"text/html; charset=utf-8", renderHTML},
+	"svg":  {"image/svg+xml", renderSVG},
+	"ansi": {"text/plain; charset=utf-8", renderANSI},
+	"css":  {"text/css; charset=utf-8", renderCSS},
+
+	"json-matrix": {"application/json", renderJSONMatrix},
+	"lottie":      {"application/json", renderLottie},
+}
+
+// renderJSONMatrix returns the module grid, quiet zone included, as rows of booleans
+// where true is a dark module, for clients drawing the code themselves.
+func renderJSONMatrix(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error) {
+	bitmap := moduleMatrix(qr, options.Border)
+	return json.Marshal(map[string]any{
+		"version":     qr.VersionNumber,
+		"error_level": options.Error,
+		"modules":     len(bitmap),
+		"border":      options.Border,
+		"matrix":      bitmap,
+	})
+}
+
+// ansiMaxColumns is the terminal width above which the ANSI output is prefixed with a size note
+const ansiMaxColumns = 80
+
+// renderANSI renders the code for truecolor terminals, drawing each module as two spaces
+// with a 24-bit background color escape so modules come out roughly square.
+func renderANSI(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error) {
+	bitmap := moduleMatrix(qr, options.Border)
+	fg := ansiBackground(qr.ForegroundColor)
+	bg := ansiBackground(qr.BackgroundColor)
+
+	var b strings.Builder
+	if columns := 2 * len(bitmap); columns > ansiMaxColumns {
+		fmt.Fprintf(&b, "QR code is %d modules wide and needs a terminal at least %d columns wide\n", len(bitmap), columns)
+	}
+	for _, row := range bitmap {
+		current := ""
+		for _, dark := range row {
+			escape := bg
+			if dark {
+				escape = fg
+			}
+			// Only emit an escape when the color changes
+			if escape != current {
+				b.WriteString(escape)
+				current = escape
+			}
+			b.WriteString("  ")
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+
+	return []byte(b.String()), nil
+}
+
+// ansiBackground returns the truecolor escape sequence setting the background to c
+func ansiBackground(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("\x1b[48;2;%d;%d;%dm", r>>8, g>>8, b>>8)
+}
+
+// renderCSS renders the code as a CSS rule for a single .qr-code div, whose ::before
+// pseudo-element is one module in the corner that box-shadow copies to every dark module.
+// The shadow list grows with the number of dark modules, a few thousand entries for
+// large versions, and browsers repaint all of them on scroll and zoom, so large codes
+// are slow to render and images remain the better choice outside small inline codes.
+func renderCSS(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error) {
+	cell := options.CellSize
+	bitmap := moduleMatrix(qr, options.Border)
+	fg := hexColor(qr.ForegroundColor)
+
+	var shadows []string
+	corner := "transparent"
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			// A box-shadow is not painted under its own box, so the corner module uses the background
+			if x == 0 && y == 0 {
+				corner = fg
+				continue
+			}
+			shadows = append(shadows, fmt.Sprintf("%dpx %dpx 0 0 %s", x*cell, y*cell, fg))
+		}
+	}
+
+	var b strings.Builder
+	size := len(bitmap) * cell
+	fmt.Fprintf(&b, ".qr-code {\n  position: relative;\n  width: %dpx;\n  height: %dpx;\n  background: %s;\n}\n", size, size, hexColor(qr.BackgroundColor))
+	fmt.Fprintf(&b, ".qr-code::before {\n  content: \"\";\n  position: absolute;\n  top: 0;\n  left: 0;\n  width: %dpx;\n  height: %dpx;\n  background: %s;\n", cell, cell, corner)
+	if len(shadows) > 0 {
+		fmt.Fprintf(&b, "  box-shadow:\n    %s;\n", strings.Join(shadows, ",\n    "))
+	}
+	b.WriteString("}\n")
+
+	return []byte(b.String()), nil
+}
+
+// renderHTML renders the code as an HTML table with one colored cell per module, for
+// email clients that block images. Scanning depends on the client keeping the cells
+// square and gap free: some clients add line-height or cell spacing, and zooming can
+// blur cells together, so image formats remain the more reliable choice.
+func renderHTML(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error) {
+	cell := options.CellSize
+	fg := hexColor(qr.ForegroundColor)
+	bg := hexColor(qr.BackgroundColor)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<table cellpadding="0" cellspacing="0" border="0" style="border-collapse:collapse;border-spacing:0;background:%s">`, bg)
+	for _, row := range moduleMatrix(qr, options.Border) {
+		b.WriteString(`<tr>`)
+		for _, dark := range row {
+			color := bg
+			if dark {
+				color = fg
+			}
+			fmt.Fprintf(&b, `<td width="%d" height="%d" bgcolor="%s" style="width:%dpx;height:%dpx;padding:0;line-height:0;font-size:0;background:%s"></td>`,
+				cell, cell, color, cell, cell, color)
+		}
+		b.WriteString(`</tr>`)
+	}
+	b.WriteString(`</table>`)
+
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRenderJSONMatrix(t *testing.T) {
+	options := testOptions("hello")
+	options.Format = "json-matrix"
+	options.Border = 2
+
+	out, _, err := renderOutput(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var matrix struct {
+		Version int      `json:"version"`
+		Modules int      `json:"modules"`
+		Border  int      `json:"border"`
+		Matrix  [][]bool `json:"matrix"`
+	}
+	if err := json.Unmarshal(out.Body, &matrix); err != nil {
+		t.Fatal(err)
+	}
+	if matrix.Version != 1 || matrix.Modules != 25 || len(matrix.Matrix) != 25 {
+		t.Fatalf("version %d with %d modules in %d rows, want version 1 with 25", matrix.Version, matrix.Modules, len(matrix.Matrix))
+	}
+	// The quiet zone is light and the finder pattern corner dark
+	if matrix.Matrix[1][1] || !matrix.Matrix[2][2] {
+		t.Error("quiet zone or finder pattern in the wrong place")
+	}
+}
+
+func TestRenderHTMLTable(t *testing.T) {
+	options := testOptions("hello")
+	options.Format = "html"
+	options.CellSize = 3
+
+	out, _, err := renderOutput(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(out.Body)
+	if rows := strings.Count(html, "<tr>"); rows != 29 {
+		t.Errorf("%d rows, want 29", rows)
+	}
+	if cells := strings.Count(html, "<td "); cells != 29*29 {
+		t.Errorf("%d cells, want %d", cells, 29*29)
+	}
+	if !strings.Contains(html, "width:3px;height:3px") {
+		t.Error("cells do not use cell_size")
+	}
+}
+
+func TestMatrixFormatsRejectLargeBorders(t *testing.T) {
+	for format := range matrixFormats {
+		options := testOptions("hello")
+		options.Format = format
+		options.Border = 60
+		if _, err := prepareOptions(&options); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if _, _, err := renderOutput(options, nil); err == nil {
+			t.Errorf("%s: rendered a border of 60 modules around a 21 module symbol", format)
+		}
+	}
+
+	options := testOptions("hello")
+	options.Format = "json-matrix"
+	options.Border = 3000
+	if _, err := prepareOptions(&options); err == nil {
+		t.Error("border=3000 passed validation")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorMessage recognizes an English error message and names its stable error code.
+// The submatches are the message arguments the translations are formatted with.
+type errorMessage struct {
+	code    string
+	pattern *regexp.Regexp
+}
+
+// errorMessages lists the recognized messages, most specific first
+var errorMessages = []errorMessage{
+	{"data_required", regexp.MustCompile(`^Data parameter is required$`)},
+	{"data_too_long", regexp.MustCompile(`^data is (\d+) bytes \((\d+) characters\); at most (\d+) bytes fit at error level (\w+)$`)},
+	{"out_of_range", regexp.MustCompile(`^(\S+) must be between (\S+) and (\S+)$`)},
+	{"below_minimum", regexp.MustCompile(`^(\S+) must be at least (\S+)$`)},
+	{"negative", regexp.MustCompile(`^(\S+) must not be negative$`)},
+	{"not_one_of", regexp.MustCompile(`^(\S+) must be one of (.+)$`)},
+	{"invalid_color", regexp.MustCompile(`^(\S+) is not a valid color: (.*)$`)},
+	{"preset_not_found", regexp.MustCompile(`^Preset not found$`)},
+	{"body_too_large", regexp.MustCompile(`^Request body exceeds the (\d+) byte limit$`)},
+	{"logo_busy", regexp.MustCompile(`^Too many concurrent logo downloads, please retry$`)},
+	{"internal_error", regexp.MustCompile(`^(Internal server error|Failed to .*)$`)},
+}
+
+// statusCodes names the error code of messages no pattern recognizes
+var statusCodes = map[int]string{
+	fiber.StatusBadRequest:            "bad_request",
+	fiber.StatusUnauthorized:          "unauthorized",
+	fiber.StatusForbidden:             "forbidden",
+	fiber.StatusNotFound:              "not_found",
+	fiber.StatusRequestEntityTooLarge: "too_large",
+	fiber.StatusUnprocessableEntity:   "unprocessable",
+	fiber.StatusTooManyRequests:       "rate_limited",
+	fiber.StatusServiceUnavailable:    "unavailable",
+	fiber.StatusInsufficientStorage:   "store_full",
+}
+
+// messageCatalog holds the translations by language and error code. English is the
+// message itself, and codes missing from a language keep the English message.
+var messageCatalog = map[string]map[string]string{
+	"de": {
+		"data_required":    "Der Parameter data ist erforderlich",
+		"data_too_long":    "data ist %[1]s Bytes lang (%[2]s Zeichen); bei Fehlerkorrektur %[4]s passen höchstens %[3]s Bytes",
+		"out_of_range":     "%[1]s muss zwischen %[2]s und %[3]s liegen",
+		"below_minimum":    "%[1]s muss mindestens %[2]s sein",
+		"negative":         "%[1]s darf nicht negativ sein",
+		"not_one_of":       "%[1]s muss einer dieser Werte sein: %[2]s",
+		"invalid_color":    "%[1]s ist keine gültige Farbe: %[2]s",
+		"preset_not_found": "Preset nicht gefunden",
+		"body_too_large":   "Der Request-Body überschreitet das Limit von %[1]s Bytes",
+		"logo_busy":        "Zu viele gleichzeitige Logo-Downloads, bitte erneut versuchen",
+		"internal_error":   "Interner Serverfehler",
+		"item":             "Eintrag %[1]s: %[2]s",
+	},
+	"es": {
+		"data_required":    "El parámetro data es obligatorio",
+		"data_too_long":    "data ocupa %[1]s bytes (%[2]s caracteres); caben como máximo %[3]s bytes con el nivel de corrección %[4]s",
+		"out_of_range":     "%[1]s debe estar entre %[2]s y %[3]s",
+		"below_minimum":    "%[1]s debe ser al menos %[2]s",
+		"negative":         "%[1]s no puede ser negativo",
+		"not_one_of":       "%[1]s debe ser uno de: %[2]s",
+		"invalid_color":    "%[1]s no es un color válido: %[2]s",
+		"preset_not_found": "Preset no encontrado",
+		"body_too_large":   "El cuerpo de la petición supera el límite de %[1]s bytes",
+		"logo_busy":        "Demasiadas descargas de logos simultáneas, inténtalo de nuevo",
+		"internal_error":   "Error interno del servidor",
+		"item":             "elemento %[1]s: %[2]s",
+	},
+	"fr": {
+		"data_required":    "Le paramètre data est obligatoire",
+		"data_too_long":    "data fait %[1]s octets (%[2]s caractères) ; au plus %[3]s octets tiennent au niveau de correction %[4]s",
+		"out_of_range":     "%[1]s doit être compris entre %[2]s et %[3]s",
+		"below_minimum":    "%[1]s doit valoir au moins %[2]s",
+		"negative":         "%[1]s ne doit pas être négatif",
+		"not_one_of":       "%[1]s doit valoir l'une de ces valeurs : %[2]s",
+		"invalid_color":    "%[1]s n'est pas une couleur valide : %[2]s",
+		"preset_not_found": "Preset introuvable",
+		"body_too_large":   "Le corps de la requête dépasse la limite de %[1]s octets",
+		"logo_busy":        "Trop de téléchargements de logos simultanés, veuillez réessayer",
+		"internal_error":   "Erreur interne du serveur",
+		"item":             "élément %[1]s : %[2]s",
+	},
+}
+
+// itemPrefix matches the batch item prefix added by itemError
+var itemPrefix = regexp.MustCompile(`^item (\d+): (.*)$`)
+
+// localizeError returns the stable code of an English error message and the message
+// translated into lang, falling back to English when there is no translation
+func localizeError(status int, message, lang string) (string, string) {
+	// Translate the message inside a batch item prefix and the prefix itself
+	if m := itemPrefix.FindStringSubmatch(message); m != nil {
+		code, inner := localizeError(status, m[2], lang)
+		if template, ok := messageCatalog[lang]["item"]; ok {
+			return code, fmt.Sprintf(template, m[1], inner)
+		}
+		return code, "item " + m[1] + ": " + inner
+	}
+
+	for _, known := range errorMessages {
+		m := known.pattern.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+		template, ok := messageCatalog[lang][known.code]
+		if !ok {
+			return known.code, message
+		}
+		args := make([]any, len(m)-1)
+		for i, arg := range m[1:] {
+			args[i] = arg
+		}
+		return known.code, fmt.Sprintf(template, args...)
+	}
+
+	if code, ok := statusCodes[status]; ok {
+		return code, message
+	}
+	return "internal_error", message
+}
+
+// requestLanguage picks the error message language from the lang query parameter, or
+// else from the highest weighted Accept-Language entry with a translation. Region
+// subtags are ignored, so de-AT selects de. The default is English.
+func requestLanguage(c *fiber.Ctx) string {
+	if lang := strings.ToLower(c.Query("lang")); lang != "" {
+		if _, ok := messageCatalog[lang]; ok {
+			return lang
+		}
+		return "en"
+	}
+
+	type candidate struct {
+		lang    string
+		quality float64
+	}
+	var candidates []candidate
+	for _, entry := range strings.Split(c.Get(fiber.HeaderAcceptLanguage), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		candidates = append(candidates, candidate{primary, quality})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+
+	for _, candidate := range candidates {
+		if _, ok := messageCatalog[candidate.lang]; ok || candidate.lang == "en" {
+			if candidate.quality > 0 {
+				return candidate.lang
+			}
+		}
+	}
+	return "en"
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultOptions holds the value used for every option the client leaves out
+var defaultOptions = QRCodeOptions{
+	Size:            300,
+	Foreground:      "black",
+	Background:      "white",
+	Error:           "M",
+	Border:          4,
+	BorderTop:       -1,
+	BorderRight:     -1,
+	BorderBottom:    -1,
+	BorderLeft:      -1,
+	LogoSize:        20.0,
+	LogoPadding:     4,
+	LogoTintMode:    "fill",
+	GradientType:    "linear",
+	PatternColor:    "rgb(220,220,220)",
+	BackgroundFit:   "cover",
+	BackgroundAlign: "center",
+	VignetteColor:   "rgb(200,200,200)",
+	LayoutFill:      "background",
+	LayoutBorder:    8,
+	RingColor:       "rgb(0,150,80)",
+	RingThickness:   8,
+	CardRadius:      24,
+	CardColor:       "white",
+	CardPadding:     24,
+	BleedColor:      "white",
+	FrameColor:      "black",
+	FrameDash:       8,
+	LabelSize:       16,
+	LabelDir:        "auto",
+	CaptionFont:     "go",
+	ModuleQuality:   "balanced",
+	LogoMaskSize:    30,
+	EyeOuterShape:   "square",
+	EyeInnerShape:   "square",
+	SplitAngle:      45,
+	ShowTextMax:     40,
+	Format:          "png",
+	Sizes:           "16,32,48,64",
+	CellSize:        4,
+	Quality:         90,
+	MinModuleMM:     0.5,
+	GoPackage:       "main",
+	GoVar:           "qrCode",
+}
+
+// applyGradientDefaults replaces the built-in gradient defaults with the operator's, so
+// requests that leave gradient_type or gradient_angle out get the deployment's style.
+// A value the option's rule rejects is logged and the built-in default kept.
+func applyGradientDefaults(cfg Config) {
+	if rule := optionRules["gradient_type"]; !slices.Contains(rule.enum, cfg.DefaultGradientType) {
+		log.Printf("invalid DEFAULT_GRADIENT_TYPE %q, using default %q", cfg.DefaultGradientType, defaultOptions.GradientType)
+	} else {
+		defaultOptions.GradientType = cfg.DefaultGradientType
+	}
+	if rule := optionRules["gradient_angle"]; !rule.allows(cfg.DefaultGradientAngle) {
+		log.Printf("invalid DEFAULT_GRADIENT_ANGLE %g, using default %g", cfg.DefaultGradientAngle, defaultOptions.GradientAngle)
+	} else {
+		defaultOptions.GradientAngle = cfg.DefaultGradientAngle
+	}
+}
+
+// extensionFormats maps the /generate.<ext> route extensions to the format they select
+var extensionFormats = map[string]string{
+	"png":  "png",
+	"jpg":  "jpeg",
+	"jpeg": "jpeg",
+	"ico":  "ico",
+	"svg":  "svg",
+	"html": "html",
+	"go":   "gocode",
+}
+
+// queryAliases maps short query parameter names to the options they stand for, for
+// embeds where URL length is tight. The full name wins when a request gives both.
+var queryAliases = map[string]string{
+	"d":  "data",
+	"s":  "size",
+	"fg": "foreground",
+	"bg": "background",
+	"e":  "error",
+}
+
+// expandQueryAliases rewrites aliased query parameters to their full names, returning
+// a warning for every alias dropped because the full name is also given with another value
+func expandQueryAliases(c *fiber.Ctx) []string {
+	var warnings []string
+	args := c.Context().QueryArgs()
+	for _, alias := range slices.Sorted(maps.Keys(queryAliases)) {
+		name := queryAliases[alias]
+		if !args.Has(alias) {
+			continue
+		}
+		value := args.Peek(alias)
+		switch {
+		case !args.Has(name):
+			args.SetBytesV(name, value)
+		case !bytes.Equal(args.Peek(name), value):
+			warnings = append(warnings, fmt.Sprintf("%s ignored because %s is set", alias, name))
+		}
+		args.Del(alias)
+	}
+	return warnings
+}
+
+// parseOptions reads the QR code options from the query string, applying defaults.
+// A preset replaces the defaults with its stored options, and on /generate.<ext>
+// routes the extension selects the default format.
+func parseOptions(c *fiber.Ctx) (QRCodeOptions, error) {
+	d := defaultOptions
+	if name := c.Query("preset"); name != "" {
+		preset, err := loadPreset(name)
+		if err != nil {
+			return QRCodeOptions{}, err
+		}
+		d = preset
+		d.Preset = name
+	}
+	if format, ok := extensionFormats[strings.TrimPrefix(path.Ext(c.Route().Path), ".")]; ok {
+		d.Format = format
+	}
+	return QRCodeOptions{
+		Preset:       d.Preset,
+		Data:         c.Query("data", d.Data),
+		Type:         c.Query("type", d.Type),
+		AutoType:     c.QueryBool("auto_type", d.AutoType),
+		Vars:         c.Query("vars", d.Vars),
+		DataEncoding: c.Query("data_encoding", d.DataEncoding),
+		Size:         c.QueryInt("size", d.Size),
+		Foreground:   c.Query("foreground", d.Foreground),
+		Background:   c.Query("background", d.Background),
+		Error:        c.Query("error", d.Error),
+		EncodingMode: c.Query("encoding_mode", d.EncodingMode),
+		Border:       c.QueryInt("border", d.Border),
+
+		BorderRadius: c.QueryInt("border_radius", d.BorderRadius),
+
+		FrameStyle: c.Query("frame_style", d.FrameStyle),
+		FrameColor: c.Query("frame_color", d.FrameColor),
+		FrameDash:  c.QueryInt("frame_dash", d.FrameDash),
+
+		BorderTop:         c.QueryInt("border_top", d.BorderTop),
+		BorderRight:       c.QueryInt("border_right", d.BorderRight),
+		BorderBottom:      c.QueryInt("border_bottom", d.BorderBottom),
+		BorderLeft:        c.QueryInt("border_left", d.BorderLeft),
+		BorderTopColor:    c.Query("border_top_color", d.BorderTopColor),
+		BorderRightColor:  c.Query("border_right_color", d.BorderRightColor),
+		BorderBottomColor: c.Query("border_bottom_color", d.BorderBottomColor),
+		BorderLeftColor:   c.Query("border_left_color", d.BorderLeftColor),
+
+		Bleed:      c.QueryInt("bleed", d.Bleed),
+		BleedColor: c.Query("bleed_color", d.BleedColor),
+
+		LogoURL:              c.Query("logo_url", d.LogoURL),
+		LogoSize:             c.QueryFloat("logo_size", d.LogoSize),
+		LogoTint:             c.Query("logo_tint", d.LogoTint),
+		LogoTintMode:         c.Query("logo_tint_mode", d.LogoTintMode),
+		LogoPlate:            c.Query("logo_plate", d.LogoPlate),
+		LogoPadding:          c.QueryInt("logo_padding", d.LogoPadding),
+		LogoPlateTransparent: c.QueryBool("logo_plate_transparent", d.LogoPlateTransparent),
+		LogoAutofit:          c.QueryBool("logo_autofit", d.LogoAutofit),
+		LogoBlend:            c.QueryFloat("logo_blend", d.LogoBlend),
+		GradientStart:        c.Query("gradient_start", d.GradientStart),
+		GradientEnd:          c.Query("gradient_end", d.GradientEnd),
+		GradientType:         c.Query("gradient_type", d.GradientType),
+
+		GradientFallback: c.Query("gradient_fallback", d.GradientFallback),
+		GradientAngle:    c.QueryFloat("gradient_angle", d.GradientAngle),
+		GradientFrom:     c.Query("gradient_from", d.GradientFrom),
+		GradientTo:       c.Query("gradient_to", d.GradientTo),
+
+		GradientAutoContrast: c.QueryBool("gradient_autocontrast", d.GradientAutoContrast),
+
+		Seed:    int64(c.QueryInt("seed", int(d.Seed))),
+		Palette: c.Query("palette", d.Palette),
+
+		ModuleJitter:  c.QueryFloat("module_jitter", d.ModuleJitter),
+		ModuleGap:     c.QueryFloat("module_gap", d.ModuleGap),
+		ModuleQuality: c.Query("module_quality", d.ModuleQuality),
+
+		ModuleImageURL: c.Query("module_image_url", d.ModuleImageURL),
+
+		SplitColors: c.Query("split_colors", d.SplitColors),
+		SplitAngle:  c.QueryFloat("split_angle", d.SplitAngle),
+
+		LogoMaskURL:  c.Query("logo_mask_url", d.LogoMaskURL),
+		LogoMaskSize: c.QueryFloat("logo_mask_size", d.LogoMaskSize),
+
+		EyeImageURL:   c.Query("eye_image_url", d.EyeImageURL),
+		EyeOuterShape: c.Query("eye_outer_shape", d.EyeOuterShape),
+		EyeInnerShape: c.Query("eye_inner_shape", d.EyeInnerShape),
+		EyeOuterColor: c.Query("eye_outer_color", d.EyeOuterColor),
+		EyeInnerColor: c.Query("eye_inner_color", d.EyeInnerColor),
+
+		BackgroundImageURL: c.Query("background_image_url", d.BackgroundImageURL),
+		BackgroundFit:      c.Query("background_fit", d.BackgroundFit),
+		BackgroundAlign:    c.Query("background_align", d.BackgroundAlign),
+
+		BackgroundPattern: c.Query("background_pattern", d.BackgroundPattern),
+		PatternColor:      c.Query("pattern_color", d.PatternColor),
+
+		Vignette:      c.QueryBool("vignette", d.Vignette),
+		VignetteColor: c.Query("vignette_color", d.VignetteColor),
+
+		Currency:      c.Query("currency", d.Currency),
+		Address:       c.Query("address", d.Address),
+		Amount:        c.Query("amount", d.Amount),
+		CryptoLabel:   c.Query("crypto_label", d.CryptoLabel),
+		CryptoMessage: c.Query("crypto_message", d.CryptoMessage),
+
+		Shape:       c.Query("shape", d.Shape),
+		ImageRadius: c.QueryInt("image_radius", d.ImageRadius),
+
+		Layout:            c.Query("layout", d.Layout),
+		LayoutFill:        c.Query("layout_fill", d.LayoutFill),
+		LayoutBorder:      c.QueryInt("layout_border", d.LayoutBorder),
+		LayoutBorderColor: c.Query("layout_border_color", d.LayoutBorderColor),
+
+		RingPercent:   c.QueryFloat("ring_percent", d.RingPercent),
+		RingColor:     c.Query("ring_color", d.RingColor),
+		RingThickness: c.QueryInt("ring_thickness", d.RingThickness),
+
+		Card:        c.QueryBool("card", d.Card),
+		CardRadius:  c.QueryInt("card_radius", d.CardRadius),
+		CardColor:   c.Query("card_color", d.CardColor),
+		CardPadding: c.QueryInt("card_padding", d.CardPadding),
+
+		Label:      c.Query("label", d.Label),
+		LabelColor: c.Query("label_color", d.LabelColor),
+		LabelSize:  c.QueryFloat("label_size", d.LabelSize),
+		LabelDir:   c.Query("label_dir", d.LabelDir),
+
+		CaptionFont:    c.Query("caption_font", d.CaptionFont),
+		CaptionFontURL: c.Query("caption_font_url", d.CaptionFontURL),
+
+		ShowText:    c.QueryBool("show_text", d.ShowText),
+		ShowTextMax: c.QueryInt("show_text_max", d.ShowTextMax),
+
+		SVGLink: c.QueryBool("svg_link", d.SVGLink),
+
+		ECOverlay: c.QueryBool("ec_overlay", d.ECOverlay),
+
+		Format:   c.Query("format", d.Format),
+		Sizes:    c.Query("sizes", d.Sizes),
+		CellSize: c.QueryInt("cell_size", d.CellSize),
+		Quality:  c.QueryInt("quality", d.Quality),
+		MaxBytes: c.QueryInt("max_bytes", d.MaxBytes),
+
+		Orientation: c.QueryInt("orientation", d.Orientation),
+
+		Safe:      c.QueryBool("safe", d.Safe),
+		PrintSafe: c.QueryBool("print_safe", d.PrintSafe),
+
+		TraceID: c.Query("trace_id", d.TraceID),
+
+		DPI:         c.QueryInt("dpi", d.DPI),
+		MinModuleMM: c.QueryFloat("min_module_mm", d.MinModuleMM),
+
+		GoPackage: c.Query("go_package", d.GoPackage),
+		GoVar:     c.Query("go_var", d.GoVar),
+	}, nil
+}
+
+// resolveOptions settles conflicts between overlapping options and returns a
+// warning for every option that was ignored or adjusted. Precedence is:
+//
+//   - a type builds data from its typed fields, replacing any data given, and data_encoding with it,
+//     unless auto_type finds data is already a complete payload such as WIFI: or BEGIN:VCARD
+//   - a complete gradient (gradient_start and gradient_end) overrides foreground
+//   - an incomplete gradient is dropped and gradient_fallback, or else foreground, is used instead
+//   - module_image_url overrides palette, split_colors, module_jitter and module_gap
+//   - a palette overrides both foreground and gradient
+//   - split_colors overrides foreground and gradient but not a palette, and split_angle only applies with it
+//   - gradient_type only applies when a gradient is used, and gradient_angle only to linear ones
+//   - gradient_from and gradient_to must be given together and override gradient_angle
+//   - logo_size, logo_tint, logo_plate, logo_autofit and logo_blend only apply when logo_url is set
+//   - logo_autofit replaces logo_size
+//   - logo_tint_mode only applies when logo_tint is set
+//   - logo_mask_size only applies when logo_mask_url is set
+//   - logo_plate_transparent only applies when logo_plate is set, and not to format=jpeg
+//   - pattern_color only applies when background_pattern is set
+//   - background_image_url replaces background_pattern and vignette, and background_fit
+//     and background_align only apply with it
+//   - vignette_color only applies when vignette is set
+//   - eye_image_url replaces eye_inner_shape and eye_inner_color
+//   - card_radius, card_color and card_padding only apply when card is set
+//   - label_color and label_size only apply when label or show_text is set
+//   - label_dir, caption_font and caption_font_url only apply when label is set, and a
+//     caption_font_url that fails to load falls back to caption_font
+//   - show_text_max only applies when show_text is set
+//   - label and show_text are dropped for matrix formats other than svg
+//   - print_safe replaces colors a CMYK press cannot reproduce with printable ones of the same
+//     lightness and hue, before any format-specific color handling
+//   - sizes only applies to format=ico, svg_link only to format=svg, quality and orientation only to format=jpeg,
+//     and go_package and go_var only to format=gocode
+//   - dpi only applies to format=png, jpeg, gocode and svg, and min_module_mm only with dpi
+//   - ring_color and ring_thickness only apply when ring_percent is set
+//   - layout=circular replaces shape, ring_percent and card, and layout_fill, layout_border
+//     and layout_border_color only apply with a layout
+//   - raster decorations (gradient, palette, split_colors, module_jitter, module_gap, module image, pattern, background image, vignette, logo, logo mask, eye image, eye shapes and colors, shape, layout, ring, card, image_radius,
+//     border_radius, frame, ec_overlay, bleed) are dropped for formats rendered from the module matrix, except gradients
+//     and logos for format=svg, where logo_blend is dropped
+//   - max_bytes only applies to format=png and format=jpeg
+//   - trace_id only applies to format=png and format=gocode, and not with max_bytes, which may rescale
+//   - format=jpeg flattens a translucent background onto white and translucent module colors
+//     onto the background, and rejects module colors that vanish into it
+//   - per-side borders and their colors only apply to raster formats
+//   - bleed_color only applies when bleed is set
+//   - border_radius only applies when there is a border
+//   - frame_color and frame_dash only apply when frame_style is set
+//   - a negative border is clamped to 0, and a zero border is reported as it may not scan
+//   - a module_gap above maxSafeModuleGap is reported as it may not scan
+//   - module_quality only applies with module_jitter or module_gap, and not with a palette,
+//     split_colors or a gradient, which recolor only solid module pixels
+func resolveOptions(options *QRCodeOptions) []string {
+	var warnings []string
+	d := defaultOptions
+
+	if options.AutoType && options.Type != "" && isStructuredPayload(options.Data) {
+		kind, _ := detectType(options.Data)
+		warnings = append(warnings, "type ignored because data is already a "+kind+" payload")
+		options.Type = ""
+	}
+	if options.Type != "" && options.Data != "" {
+		warnings = append(warnings, "data ignored because type is set")
+	}
+	if options.Type != "" && options.DataEncoding != d.DataEncoding {
+		warnings = append(warnings, "data_encoding ignored because type is set")
+		options.DataEncoding = d.DataEncoding
+	}
+
+	if options.ModuleImageURL != "" && (options.Palette != "" || options.SplitColors != "" || options.ModuleJitter != 0 || options.ModuleGap != 0) {
+		warnings = append(warnings, "palette, split_colors, module_jitter and module_gap ignored because module_image_url is set")
+		options.Palette, options.SplitColors, options.ModuleJitter, options.ModuleGap = "", "", 0, 0
+	}
+
+	if options.Palette != "" && options.SplitColors != "" {
+		warnings = append(warnings, "split_colors ignored because a palette is set")
+		options.SplitColors = ""
+	}
+	if options.SplitColors != "" && (options.GradientStart != "" || options.GradientEnd != "") {
+		warnings = append(warnings, "gradient ignored because split_colors is set")
+		options.GradientStart, options.GradientEnd = "", ""
+	}
+	if options.SplitColors != "" && options.Foreground != d.Foreground {
+		warnings = append(warnings, "foreground ignored because split_colors is set")
+	}
+	if options.SplitColors == "" && options.SplitAngle != d.SplitAngle {
+		warnings = append(warnings, "split_angle ignored because split_colors is not set")
+	}
+
+	if options.Palette != "" && (options.GradientStart != "" || options.GradientEnd != "") {
+		warnings = append(warnings, "gradient ignored because a palette is set")
+		options.GradientStart, options.GradientEnd = "", ""
+	}
+
+	hasGradient := options.GradientStart != "" && options.GradientEnd != ""
+	incompleteGradient := !hasGradient && (options.GradientStart != "" || options.GradientEnd != "")
+	switch {
+	case hasGradient && options.Foreground != d.Foreground:
+		warnings = append(warnings, "foreground ignored because a gradient is set")
+	case incompleteGradient:
+		if options.GradientFallback != "" {
+			warnings = append(warnings, "gradient replaced by gradient_fallback because gradient_start and gradient_end are both required")
+			options.Foreground = options.GradientFallback
+		} else {
+			warnings = append(warnings, "gradient ignored because gradient_start and gradient_end are both required")
+		}
+		options.GradientStart, options.GradientEnd = "", ""
+	}
+	if !incompleteGradient && options.GradientFallback != "" {
+		warnings = append(warnings, "gradient_fallback ignored because it only applies when one of gradient_start and gradient_end is missing")
+		options.GradientFallback = ""
+	}
+	if !hasGradient && options.GradientType != d.GradientType {
+		warnings = append(warnings, "gradient_type ignored because no gradient is set")
+	}
+	linear := hasGradient && options.GradientType != "radial"
+	if !linear && (options.GradientAngle != d.GradientAngle || options.GradientFrom != "" || options.GradientTo != "") {
+		warnings = append(warnings, "gradient_angle, gradient_from and gradient_to ignored because no linear gradient is set")
+		options.GradientFrom, options.GradientTo = "", ""
+	}
+	if (options.GradientFrom == "") != (options.GradientTo == "") {
+		warnings = append(warnings, "gradient_from and gradient_to ignored because both are required")
+		options.GradientFrom, options.GradientTo = "", ""
+	}
+	if options.GradientFrom != "" && options.GradientAngle != d.GradientAngle {
+		warnings = append(warnings, "gradient_angle ignored because gradient_from and gradient_to are set")
+	}
+
+	if options.LogoURL == "" && (options.LogoSize != d.LogoSize || options.LogoTint != d.LogoTint || options.LogoPlate != d.LogoPlate || options.LogoAutofit || options.LogoBlend != d.LogoBlend) {
+		warnings = append(warnings, "logo_size, logo_tint, logo_plate, logo_autofit and logo_blend ignored because logo_url is not set")
+		options.LogoAutofit = false
+	}
+	if options.LogoMaskURL == "" && options.LogoMaskSize != d.LogoMaskSize {
+		warnings = append(warnings, "logo_mask_size ignored because logo_mask_url is not set")
+	}
+	if (options.LogoURL == "" || options.LogoPlate == "") && options.LogoPlateTransparent {
+		warnings = append(warnings, "logo_plate_transparent ignored because logo_plate is not set")
+		options.LogoPlateTransparent = false
+	}
+	if options.LogoTint == "" && options.LogoTintMode != d.LogoTintMode {
+		warnings = append(warnings, "logo_tint_mode ignored because logo_tint is not set")
+	}
+	if options.LogoAutofit && options.LogoSize != d.LogoSize {
+		warnings = append(warnings, "logo_size ignored because logo_autofit is set")
+	}
+
+	if options.BackgroundImageURL != "" && (options.BackgroundPattern != "" || options.Vignette) {
+		warnings = append(warnings, "background_pattern and vignette ignored because background_image_url is set")
+		options.BackgroundPattern, options.Vignette = "", false
+	}
+	if options.BackgroundImageURL == "" && (options.BackgroundFit != d.BackgroundFit || options.BackgroundAlign != d.BackgroundAlign) {
+		warnings = append(warnings, "background_fit and background_align ignored because background_image_url is not set")
+	}
+
+	if options.BackgroundPattern == "" && options.PatternColor != d.PatternColor {
+		warnings = append(warnings, "pattern_color ignored because background_pattern is not set")
+	}
+
+	if !options.Vignette && options.VignetteColor != d.VignetteColor {
+		warnings = append(warnings, "vignette_color ignored because vignette is not set")
+	}
+
+	if options.EyeImageURL != "" && (options.EyeInnerShape != d.EyeInnerShape || options.EyeInnerColor != "") {
+		warnings = append(warnings, "eye_inner_shape and eye_inner_color ignored because eye_image_url is set")
+		options.EyeInnerShape, options.EyeInnerColor = d.EyeInnerShape, ""
+	}
+
+	if options.Layout == "circular" && (options.Shape != "" || options.RingPercent != 0 || options.Card) {
+		warnings = append(warnings, "shape, ring_percent and card ignored because layout=circular is set")
+		options.Shape, options.RingPercent, options.Card = "", 0, false
+	}
+	if options.Layout == "" && (options.LayoutFill != d.LayoutFill || options.LayoutBorder != d.LayoutBorder || options.LayoutBorderColor != d.LayoutBorderColor) {
+		warnings = append(warnings, "layout_fill, layout_border and layout_border_color ignored because layout is not set")
+	}
+	if options.Layout == "circular" && options.LayoutFill == "modules" && options.Border < 2 {
+		warnings = append(warnings, "layout_fill=modules runs up to the code because border is below 2, so some scanners may fail to read it")
+	}
+
+	if options.RingPercent == 0 && (options.RingColor != d.RingColor || options.RingThickness != d.RingThickness) {
+		warnings = append(warnings, "ring_color and ring_thickness ignored because ring_percent is not set")
+	}
+
+	if !options.Card && (options.CardRadius != d.CardRadius || options.CardColor != d.CardColor || options.CardPadding != d.CardPadding) {
+		warnings = append(warnings, "card_radius, card_color and card_padding ignored because card is not set")
+	}
+
+	if options.Label == "" && !options.ShowText && (options.LabelColor != d.LabelColor || options.LabelSize != d.LabelSize) {
+		warnings = append(warnings, "label_color and label_size ignored because neither label nor show_text is set")
+	}
+	if options.Label == "" && options.LabelDir != d.LabelDir {
+		warnings = append(warnings, "label_dir ignored because label is not set")
+	}
+	if options.Label == "" && (options.CaptionFont != d.CaptionFont || options.CaptionFontURL != "") {
+		warnings = append(warnings, "caption_font and caption_font_url ignored because label is not set")
+		options.CaptionFont, options.CaptionFontURL = d.CaptionFont, ""
+	}
+	if !options.ShowText && options.ShowTextMax != d.ShowTextMax {
+		warnings = append(warnings, "show_text_max ignored because show_text is not set")
+	}
+	if _, ok := matrixFormats[options.Format]; ok && (options.Label != "" || options.ShowText) && options.Format != "svg" {
+		warnings = append(warnings, fmt.Sprintf("label and show_text ignored for format=%s", options.Format))
+		options.Label = ""
+		options.ShowText = false
+	}
+
+	if options.Format != "ico" && options.Sizes != d.Sizes {
+		warnings = append(warnings, "sizes ignored because format is not ico")
+	}
+
+	if options.Format != "svg" && options.SVGLink {
+		warnings = append(warnings, "svg_link ignored because format is not svg")
+		options.SVGLink = false
+	}
+
+	if options.PrintSafe {
+		warnings = append(warnings, clampPrintColors(options)...)
+	}
+
+	if options.DPI > 0 && !printFormats[options.Format] {
+		warnings = append(warnings, fmt.Sprintf("dpi ignored because format=%s has no print size", options.Format))
+		options.DPI = 0
+	}
+	if options.DPI == 0 && options.MinModuleMM != d.MinModuleMM {
+		warnings = append(warnings, "min_module_mm ignored because dpi is not set")
+	}
+
+	if options.Format != "gocode" && (options.GoPackage != d.GoPackage || options.GoVar != d.GoVar) {
+		warnings = append(warnings, "go_package and go_var ignored because format is not gocode")
+		options.GoPackage, options.GoVar = d.GoPackage, d.GoVar
+	}
+
+	if options.TraceID != "" && options.Format != "png" && options.Format != "gocode" {
+		warnings = append(warnings, fmt.Sprintf("trace_id ignored because format=%s does not keep exact pixels", options.Format))
+		options.TraceID = ""
+	}
+	if options.TraceID != "" && options.MaxBytes > 0 {
+		warnings = append(warnings, "trace_id ignored because max_bytes may rescale the image")
+		options.TraceID = ""
+	}
+
+	if options.MaxBytes > 0 && options.Format != "png" && options.Format != "jpeg" {
+		warnings = append(warnings, "max_bytes ignored because format is not png or jpeg")
+		options.MaxBytes = 0
+	}
+
+	if options.Format != "jpeg" && (options.Quality != d.Quality || options.Orientation != d.Orientation) {
+		warnings = append(warnings, "quality and orientation ignored because format is not jpeg")
+		options.Orientation = d.Orientation
+	}
+	if options.Format == "jpeg" && options.LogoPlateTransparent {
+		warnings = append(warnings, "logo_plate_transparent ignored because format=jpeg has no transparency")
+		options.LogoPlateTransparent = false
+	}
+	if options.Format == "jpeg" && (options.Shape != "" || options.Card || options.ImageRadius > 0 || options.Layout != "") {
+		warnings = append(warnings, "transparent areas are filled with the background color for format=jpeg")
+	}
+	if options.Format == "jpeg" {
+		if bg, ok := lookupColor(options.Background); ok && !isOpaque(bg) {
+			warnings = append(warnings, "background transparency is flattened against white for format=jpeg")
+		}
+		for _, name := range translucentModuleColors(*options) {
+			warnings = append(warnings, name+" transparency is flattened against the background for format=jpeg")
+		}
+	}
+
+	if _, ok := matrixFormats[options.Format]; ok {
+		// SVG renders gradients natively and embeds logos, so they are not counted or cleared for it
+		keepSVG := options.Format == "svg"
+		decorations := *options
+		if keepSVG {
+			decorations.GradientStart, decorations.GradientEnd = "", ""
+			decorations.LogoURL = ""
+		}
+		if hasRasterDecorations(decorations) {
+			warnings = append(warnings, fmt.Sprintf("raster decorations ignored for format=%s", options.Format))
+			start, end, logo := options.GradientStart, options.GradientEnd, options.LogoURL
+			clearRasterDecorations(options)
+			if keepSVG {
+				options.GradientStart, options.GradientEnd, options.LogoURL = start, end, logo
+			}
+		}
+		if keepSVG && options.LogoURL != "" && options.LogoBlend != d.LogoBlend {
+			warnings = append(warnings, "logo_blend ignored for format=svg")
+			options.LogoBlend = d.LogoBlend
+		}
+	}
+
+	if options.BorderRadius > 0 && options.Border <= 0 {
+		if _, set := resolveSideBorders(*options); !set {
+			warnings = append(warnings, "border_radius ignored because border is 0")
+			options.BorderRadius = 0
+		}
+	}
+
+	if options.FrameStyle == "" && (options.FrameColor != d.FrameColor || options.FrameDash != d.FrameDash) {
+		warnings = append(warnings, "frame_color and frame_dash ignored because frame_style is not set")
+	}
+
+	if options.Bleed == 0 && options.BleedColor != d.BleedColor {
+		warnings = append(warnings, "bleed_color ignored because bleed is not set")
+	}
+
+	if _, ok := matrixFormats[options.Format]; ok {
+		if _, set := resolveSideBorders(*options); set {
+			warnings = append(warnings, fmt.Sprintf("per-side borders ignored for format=%s", options.Format))
+			options.BorderTop, options.BorderRight, options.BorderBottom, options.BorderLeft = -1, -1, -1, -1
+			options.BorderTopColor, options.BorderRightColor, options.BorderBottomColor, options.BorderLeftColor = "", "", "", ""
+		}
+	}
+
+	if options.Border < 0 {
+		warnings = append(warnings, "border clamped to 0")
+		options.Border = 0
+	}
+	if options.Border == 0 {
+		warnings = append(warnings, "border=0 removes the quiet zone, so some scanners may fail to read the code")
+	}
+	styled := options.ModuleJitter > 0 || options.ModuleGap > 0
+	recolored := options.Palette != "" || options.SplitColors != "" || (options.GradientStart != "" && options.GradientEnd != "")
+	switch {
+	case !styled && options.ModuleQuality != d.ModuleQuality:
+		warnings = append(warnings, "module_quality ignored because neither module_jitter nor module_gap is set")
+		options.ModuleQuality = d.ModuleQuality
+	case styled && recolored:
+		if options.ModuleQuality != d.ModuleQuality {
+			warnings = append(warnings, "module_quality ignored because palette, split_colors and gradients recolor only solid module pixels")
+		}
+		// Blended edge pixels would keep the foreground color under the new colors
+		options.ModuleQuality = "fast"
+	}
+	if options.ModuleGap > maxSafeModuleGap {
+		warnings = append(warnings, fmt.Sprintf("module_gap above %d leaves modules too small for some scanners to read the code", maxSafeModuleGap))
+	}
+
+	return warnings
+}
+
+// moduleColors returns the option names and values of the colors modules are drawn with
+func moduleColors(o QRCodeOptions) ([]string, []string) {
+	if o.GradientStart != "" && o.GradientEnd != "" {
+		return []string{"gradient_start", "gradient_end"}, []string{o.GradientStart, o.GradientEnd}
+	}
+	return []string{"foreground"}, []string{o.Foreground}
+}
+
+// translucentModuleColors names the module colors that are not fully opaque
+func translucentModuleColors(o QRCodeOptions) []string {
+	var translucent []string
+	names, values := moduleColors(o)
+	for i, value := range values {
+		if c, ok := lookupColor(value); ok && !isOpaque(c) {
+			translucent = append(translucent, names[i])
+		}
+	}
+	return translucent
+}
+
+// jpegModulesVanish reports whether every module color flattens to the JPEG background
+func jpegModulesVanish(o QRCodeOptions) bool {
+	matte := jpegMatte(o.Background)
+	_, values := moduleColors(o)
+	for _, value := range values {
+		if flattenColor(parseColor(value), matte) != matte {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRasterDecorations reports whether any option that only applies to raster output is set
+func hasRasterDecorations(o QRCodeOptions) bool {
+	return o.GradientStart != "" || o.GradientEnd != "" ||
+		o.Palette != "" ||
+		o.SplitColors != "" ||
+		o.ModuleJitter != 0 ||
+		o.ModuleGap != 0 ||
+		o.ModuleImageURL != "" ||
+		o.BackgroundPattern != "" ||
+		o.BackgroundImageURL != "" ||
+		o.Vignette ||
+		o.LogoURL != "" ||
+		o.LogoMaskURL != "" ||
+		o.EyeImageURL != "" ||
+		o.EyeOuterShape != defaultOptions.EyeOuterShape || o.EyeInnerShape != defaultOptions.EyeInnerShape ||
+		o.EyeOuterColor != "" || o.EyeInnerColor != "" ||
+		o.Shape != "" ||
+		o.Layout != "" ||
+		o.RingPercent != 0 ||
+		o.Card ||
+		o.ImageRadius != 0 ||
+		o.BorderRadius != 0 ||
+		o.FrameStyle != "" ||
+		o.ECOverlay ||
+		o.Bleed != 0
+}
+
+// clearRasterDecorations turns off every option that only applies to raster output
+func clearRasterDecorations(o *QRCodeOptions) {
+	o.GradientStart, o.GradientEnd = "", ""
+	o.Palette = ""
+	o.SplitColors = ""
+	o.ModuleJitter = 0
+	o.ModuleGap = 0
+	o.ModuleImageURL = ""
+	o.BackgroundPattern = ""
+	o.BackgroundImageURL = ""
+	o.Vignette = false
+	o.LogoURL = ""
+	o.LogoMaskURL = ""
+	o.EyeImageURL = ""
+	o.EyeOuterShape, o.EyeInnerShape = defaultOptions.EyeOuterShape, defaultOptions.EyeInnerShape
+	o.EyeOuterColor, o.EyeInnerColor = "", ""
+	o.Shape = ""
+	o.Layout = ""
+	o.RingPercent = 0
+	o.Card = false
+	o.ImageRadius = 0
+	o.BorderRadius = 0
+	o.FrameStyle = ""
+	o.ECOverlay = false
+	o.Bleed = 0
+}
+
+// setWarnings reports ignored or adjusted options in the X-QR-Warnings header
+func setWarnings(c *fiber.Ctx, warnings []string) {
+	if len(warnings) > 0 {
+		c.Set("X-QR-Warnings", strings.Join(warnings, "; "))
+	}
+}
+
+// validateOptions rejects invalid options and normalizes the ones that can be clamped
+func validateOptions(options *QRCodeOptions) error {
+	if options.Data == "" {
+		return fiber.NewError(400, "Data parameter is required")
+	}
+	if len(options.TraceID) > maxTraceIDLength {
+		return fiber.NewError(400, fmt.Sprintf("trace_id must be at most %d bytes", maxTraceIDLength))
+	}
+	if n := utf8.RuneCountInString(options.Label); n > maxLabelLength {
+		return fiber.NewError(400, fmt.Sprintf("label must be at most %d characters, not %d", maxLabelLength, n))
+	}
+	// Searching every version for data that cannot fit is slow, so refuse it up front
+	if config.MaxDataLength > 0 && len(options.Data) > config.MaxDataLength {
+		return fiber.NewError(400, fmt.Sprintf("data is %d bytes, above the limit of %d", len(options.Data), config.MaxDataLength))
+	}
+	// Text is written as UTF-8 bytes without an ECI header, which go-qrcode cannot emit.
+	// Most phone scanners (iOS camera, Google Lens, ZXing) detect UTF-8 anyway, including
+	// emoji; some older readers assume ISO-8859-1 and show mojibake for non-ASCII text.
+	if options.DataEncoding != "base64" && !utf8.ValidString(options.Data) {
+		return fiber.NewError(400, "data must be valid UTF-8; use data_encoding=base64 for binary data")
+	}
+
+	if err := checkOptionRules(options); err != nil {
+		return err
+	}
+
+	// go-qrcode already picks the most compact mode for the data, so the hint
+	// only guards against data drifting out of the mode the client sized it for
+	if (options.EncodingMode == "numeric" || options.EncodingMode == "alphanumeric") && !fitsEncodingMode(options.Data, options.EncodingMode) {
+		return fiber.NewError(400, fmt.Sprintf("data contains characters outside encoding_mode=%s", options.EncodingMode))
+	}
+
+	if len(config.AllowedSizes) > 0 && !slices.Contains(config.AllowedSizes, options.Size) {
+		allowed := make([]string, len(config.AllowedSizes))
+		for i, size := range config.AllowedSizes {
+			allowed[i] = strconv.Itoa(size)
+		}
+		return fiber.NewError(400, "size must be one of "+strings.Join(allowed, ", "))
+	}
+
+	if _, _, ok := parseSplitColors(options.SplitColors); options.SplitColors != "" && !ok {
+		return fiber.NewError(400, "split_colors must be two semicolon separated colors")
+	}
+
+	if len(config.AllowedFormats) > 0 && !slices.Contains(config.AllowedFormats, options.Format) {
+		return fiber.NewError(400, "format must be one of "+strings.Join(config.AllowedFormats, ", "))
+	}
+
+	if options.Format == "gocode" {
+		if !isGoIdentifier(options.GoPackage) {
+			return fiber.NewError(400, "go_package must be a Go identifier")
+		}
+		if !isGoIdentifier(options.GoVar) {
+			return fiber.NewError(400, "go_var must be a Go identifier")
+		}
+	}
+
+	// Flattening cannot rescue modules that become the color of the background
+	if options.Format == "jpeg" && jpegModulesVanish(*options) {
+		return fiber.NewError(400, "foreground is indistinguishable from the background once format=jpeg flattens transparency")
+	}
+
+	if options.GradientFrom != "" {
+		x1, y1, okFrom := parsePoint(options.GradientFrom)
+		x2, y2, okTo := parsePoint(options.GradientTo)
+		if !okFrom || !okTo {
+			return fiber.NewError(400, "gradient_from and gradient_to must be normalized x,y pairs such as 0,0 and 1,1")
+		}
+		if x1 == x2 && y1 == y2 {
+			return fiber.NewError(400, "gradient_from and gradient_to must be different points")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApplyGradientDefaults(t *testing.T) {
+	builtin := defaultOptions
+	defer func() { defaultOptions = builtin }()
+
+	for _, tc := range []struct {
+		angle, want float64
+	}{
+		{45, 45},
+		{-360, -360},
+		{361, builtin.GradientAngle},
+		{math.NaN(), builtin.GradientAngle},
+		{math.Inf(1), builtin.GradientAngle},
+	} {
+		defaultOptions = builtin
+		applyGradientDefaults(Config{DefaultGradientType: "radial", DefaultGradientAngle: tc.angle})
+		if defaultOptions.GradientAngle != tc.want || defaultOptions.GradientType != "radial" {
+			t.Errorf("DEFAULT_GRADIENT_ANGLE=%g: angle %g and type %q, want %g and radial", tc.angle, defaultOptions.GradientAngle, defaultOptions.GradientType, tc.want)
+		}
+	}
+
+	defaultOptions = builtin
+	applyGradientDefaults(Config{DefaultGradientType: "conic", DefaultGradientAngle: 90})
+	if defaultOptions.GradientType != builtin.GradientType || defaultOptions.GradientAngle != 90 {
+		t.Errorf("DEFAULT_GRADIENT_TYPE=conic: type %q, angle %g", defaultOptions.GradientType, defaultOptions.GradientAngle)
+	}
+}
+
+func TestGradientAngleRejectsNaN(t *testing.T) {
+	for _, angle := range []float64{math.NaN(), 400} {
+		options := testOptions("hello")
+		options.GradientAngle = angle
+		if err := checkOptionRules(&options); err == nil {
+			t.Errorf("gradient_angle=%g passed validation", angle)
+		}
+	}
+}
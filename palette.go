@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// minModuleContrast is the lowest contrast ratio against the background a module color may have
+const minModuleContrast = 3.0
+
+// parsePalette parses a semicolon separated color list, dropping colors too close to the background
+func parsePalette(list string, bg color.Color) ([]color.Color, []string, error) {
+	var palette []color.Color
+	var warnings []string
+
+	for _, entry := range strings.Split(list, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		c := parseColor(entry)
+		if contrastRatio(c, bg) < minModuleContrast {
+			warnings = append(warnings, fmt.Sprintf("palette color %s dropped for low contrast with the background", entry))
+			continue
+		}
+		palette = append(palette, c)
+	}
+
+	if len(palette) == 0 {
+		return nil, warnings, fiber.NewError(400, "palette must contain at least one color with enough contrast against the background")
+	}
+	return palette, warnings, nil
+}
+
+// isFinderModule reports whether module (x, y) of an n-module symbol offset by quiet zone q
+// lies in one of the three finder patterns, including their separators
+func isFinderModule(x, y, n, q int) bool {
+	x, y = x-q, y-q
+	inStart := func(v int) bool { return v >= 0 && v < 8 }
+	inEnd := func(v int) bool { return v >= n-8 && v < n }
+	return (inStart(x) && inStart(y)) || (inEnd(x) && inStart(y)) || (inStart(x) && inEnd(y))
+}
+
+// applyPalette recolors each dark module with a color picked from the palette by a
+// deterministic random source, so the same seed and data always yield the same image.
+// Finder patterns keep the foreground color so the code stays easy to locate.
+func applyPalette(img image.Image, bitmap [][]bool, quietZone int, fg color.Color, palette []color.Color, seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	modules := len(bitmap)
+	symbol := modules - 2*quietZone
+
+	// Pick a color per module in row-major order so the choice does not depend on image size
+	colors := make([][]color.Color, modules)
+	for my := range colors {
+		colors[my] = make([]color.Color, modules)
+		for mx := range colors[my] {
+			if isFinderModule(mx, my, symbol, quietZone) {
+				colors[my][mx] = fg
+			} else {
+				colors[my][mx] = palette[rng.Intn(len(palette))]
+			}
+		}
+	}
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	modulesPerPixel := float64(modules) / float64(bounds.Dx())
+
+	for y := 0; y < bounds.Dy(); y++ {
+		my := int(float64(y) * modulesPerPixel)
+		for x := 0; x < bounds.Dx(); x++ {
+			mx := int(float64(x) * modulesPerPixel)
+			if isForeground(img.At(x, y), fg) {
+				result.Set(x, y, colors[my][mx])
+			} else {
+				result.Set(x, y, img.At(x, y))
+			}
+		}
+	}
+
+	return result
+}
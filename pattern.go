@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// minPatternLuminance keeps background patterns light enough to contrast with dark modules
+const minPatternLuminance = 0.6
+
+// lightenPatternColor blends a pattern color towards white until it is light enough
+func lightenPatternColor(c color.Color) color.Color {
+	for t := 0.0; t < 1.0; t += 0.05 {
+		mixed := mixColors(c, color.White, t)
+		if relativeLuminance(mixed) >= minPatternLuminance {
+			return mixed
+		}
+	}
+	return color.White
+}
+
+// patternHit reports whether the pixel at (x, y) belongs to the pattern stroke
+func patternHit(pattern string, x, y, cell int) bool {
+	switch pattern {
+	case "dots":
+		cx, cy := x%cell-cell/2, y%cell-cell/2
+		radius := cell / 5
+		if radius < 1 {
+			radius = 1
+		}
+		return cx*cx+cy*cy <= radius*radius
+	case "grid":
+		line := cell / 10
+		if line < 1 {
+			line = 1
+		}
+		return x%cell < line || y%cell < line
+	case "stripes":
+		return (x+y)%cell < cell/4+1
+	default:
+		return false
+	}
+}
+
+// applyBackgroundPattern fills the background of img with a generated pattern,
+// leaving every pixel that matches the foreground color of mask untouched
+func applyBackgroundPattern(img, mask image.Image, fg color.Color, pattern string, patternColor color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	patternColor = lightenPatternColor(patternColor)
+
+	cell := bounds.Dx() / 50
+	if cell < 4 {
+		cell = 4
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !isForeground(mask.At(x, y), fg) && patternHit(pattern, x, y, cell) {
+				result.Set(x, y, patternColor)
+			} else {
+				result.Set(x, y, img.At(x, y))
+			}
+		}
+	}
+
+	return result
+}
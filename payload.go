@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cryptoCurrency describes the URI scheme and address format of a supported currency
+type cryptoCurrency struct {
+	scheme       string
+	address      *regexp.Regexp
+	amountParam  string // query parameter carrying the amount
+	amountExp    string // exponent appended to the amount, e.g. "e18" for wei
+	labelParam   string
+	messageParam string
+}
+
+// cryptoCurrencies maps the accepted currency names to their URI formats
+var cryptoCurrencies = map[string]cryptoCurrency{
+	"bitcoin": {
+		scheme:      "bitcoin",
+		address:     regexp.MustCompile(`^([13][1-9A-HJ-NP-Za-km-z]{25,34}|bc1[ac-hj-np-z02-9]{11,71})$`),
+		amountParam: "amount", labelParam: "label", messageParam: "message",
+	},
+	"litecoin": {
+		scheme:      "litecoin",
+		address:     regexp.MustCompile(`^([LM3][1-9A-HJ-NP-Za-km-z]{26,33}|ltc1[ac-hj-np-z02-9]{11,71})$`),
+		amountParam: "amount", labelParam: "label", messageParam: "message",
+	},
+	"dogecoin": {
+		scheme:      "dogecoin",
+		address:     regexp.MustCompile(`^[DA9][1-9A-HJ-NP-Za-km-z]{33}$`),
+		amountParam: "amount", labelParam: "label", messageParam: "message",
+	},
+	"bitcoincash": {
+		scheme:      "bitcoincash",
+		address:     regexp.MustCompile(`^(bitcoincash:)?[qp][ac-hj-np-z02-9]{41}$`),
+		amountParam: "amount", labelParam: "label", messageParam: "message",
+	},
+	"ethereum": {
+		// EIP-681 expresses the amount in wei, scientific notation is allowed
+		scheme:      "ethereum",
+		address:     regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`),
+		amountParam: "value", amountExp: "e18",
+	},
+	"monero": {
+		scheme:      "monero",
+		address:     regexp.MustCompile(`^[48][1-9A-HJ-NP-Za-km-z]{94}$`),
+		amountParam: "tx_amount", labelParam: "recipient_name", messageParam: "tx_description",
+	},
+}
+
+// amountPattern matches a positive decimal amount
+var amountPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// uriEscape percent-encodes a URI query value, using %20 rather than + for spaces
+func uriEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// placeholderPattern matches template placeholders such as {{id}}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// applyTemplate substitutes the {{name}} placeholders in data with the values of the
+// vars JSON object. Every placeholder must have a value.
+func applyTemplate(data, vars string) (string, error) {
+	var values map[string]any
+	if err := json.Unmarshal([]byte(vars), &values); err != nil {
+		return "", fiber.NewError(400, "vars must be a JSON object")
+	}
+
+	var missing []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(data, -1) {
+		if _, ok := values[match[1]]; !ok && !slices.Contains(missing, match[1]) {
+			missing = append(missing, match[1])
+		}
+	}
+	if len(missing) > 0 {
+		return "", fiber.NewError(400, "vars is missing values for placeholders: "+strings.Join(missing, ", "))
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(data, func(placeholder string) string {
+		value := values[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+		if s, ok := value.(string); ok {
+			return s
+		}
+		return fmt.Sprint(value)
+	}), nil
+}
+
+// buildPayload assembles options.Data from the typed parameters when a type is set
+func buildPayload(options *QRCodeOptions) error {
+	switch options.Type {
+	case "":
+		return nil
+	case "crypto":
+		data, err := buildCryptoURI(options)
+		if err != nil {
+			return err
+		}
+		options.Data = data
+		return nil
+	default:
+		return fiber.NewError(400, "type must be crypto")
+	}
+}
+
+// isWebURL reports whether data is an absolute http or https URL
+func isWebURL(data string) bool {
+	u, err := url.Parse(data)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// decodeData replaces base64 data with the raw bytes it encodes, accepting the standard
+// and URL-safe alphabets with or without padding. The bytes are encoded in byte mode.
+func decodeData(options *QRCodeOptions) error {
+	switch options.DataEncoding {
+	case "", "text":
+		return nil
+	case "base64":
+	default:
+		return fiber.NewError(400, "data_encoding must be one of text, base64")
+	}
+
+	encoded := strings.TrimRight(options.Data, "=")
+	var raw []byte
+	var err error
+	if strings.ContainsAny(encoded, "-_") {
+		raw, err = base64.RawURLEncoding.DecodeString(encoded)
+	} else {
+		raw, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return fiber.NewError(400, "data is not valid base64")
+	}
+
+	level := getErrorCorrection(options.Error)
+	if limit := maxDataLength(level, "byte", 40); len(raw) > limit {
+		return fiber.NewError(400, fmt.Sprintf("decoded data is %d bytes; at most %d fit at error level %s", len(raw), limit, options.Error))
+	}
+	options.Data = string(raw)
+	return nil
+}
+
+// buildCryptoURI builds a payment URI such as bitcoin:<address>?amount=<x>&label=<y>
+func buildCryptoURI(options *QRCodeOptions) (string, error) {
+	currency, ok := cryptoCurrencies[strings.ToLower(options.Currency)]
+	if !ok {
+		return "", fiber.NewError(400, "currency must be one of bitcoin, bitcoincash, dogecoin, ethereum, litecoin, monero")
+	}
+	if !currency.address.MatchString(options.Address) {
+		return "", fiber.NewError(400, fmt.Sprintf("address is not a valid %s address", options.Currency))
+	}
+
+	address := strings.TrimPrefix(options.Address, currency.scheme+":")
+
+	var params []string
+	if options.Amount != "" {
+		if !amountPattern.MatchString(options.Amount) {
+			return "", fiber.NewError(400, "amount must be a positive decimal number")
+		}
+		params = append(params, currency.amountParam+"="+options.Amount+currency.amountExp)
+	}
+	if options.CryptoLabel != "" && currency.labelParam != "" {
+		params = append(params, currency.labelParam+"="+uriEscape(options.CryptoLabel))
+	}
+	if options.CryptoMessage != "" && currency.messageParam != "" {
+		params = append(params, currency.messageParam+"="+uriEscape(options.CryptoMessage))
+	}
+
+	uri := currency.scheme + ":" + address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestBase64DataDecodesToRawBytes(t *testing.T) {
+	raw := []byte{0x00, 0xff, 0x80, 0x10, 0xde, 0xad, 0xbe, 0xef, 0x0a, 0xc3, 0x28}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawURLEncoding} {
+		options := testOptions(encoding.EncodeToString(raw))
+		options.DataEncoding = "base64"
+		img := renderCode(t, options)
+
+		got, err := decodeImage(img)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !bytes.Equal(got, raw) {
+			t.Errorf("decoded % x, want % x", got, raw)
+		}
+	}
+}
+
+func TestBase64DataValidation(t *testing.T) {
+	for name, data := range map[string]string{
+		"invalid":  "not base64!",
+		"too long": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 2400))),
+	} {
+		options := testOptions(data)
+		options.DataEncoding = "base64"
+		if _, err := prepareOptions(&options); err == nil {
+			t.Errorf("%s data accepted", name)
+		}
+	}
+}
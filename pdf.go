@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// pdfImage is an image placed on a PDF page; the box is in points from the bottom-left corner
+type pdfImage struct {
+	img        image.Image
+	x, y, w, h float64
+}
+
+// pdfWriter numbers objects and records their offsets for the cross-reference table
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets []int // byte offset of each object, by object number - 1
+}
+
+func (p *pdfWriter) printf(format string, args ...any) {
+	n, _ := fmt.Fprintf(p.w, format, args...)
+	p.offset += n
+}
+
+func (p *pdfWriter) write(b []byte) {
+	n, _ := p.w.Write(b)
+	p.offset += n
+}
+
+// object starts object number id, which must be the next one in order
+func (p *pdfWriter) object(id int) {
+	p.offsets = append(p.offsets, p.offset)
+	p.printf("%d 0 obj\n", id)
+}
+
+// stream writes a stream object holding data with the given extra dictionary entries
+func (p *pdfWriter) stream(id int, dict string, data []byte) {
+	p.object(id)
+	p.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	p.write(data)
+	p.printf("\nendstream\nendobj\n")
+}
+
+// writePDF writes a PDF with one width x height point page per entry of pages. Images are
+// flattened onto white and embedded at their own resolution, scaled into their box.
+func writePDF(w io.Writer, width, height float64, pages [][]pdfImage) error {
+	p := &pdfWriter{w: bufio.NewWriter(w)}
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and page tree; each page takes a page object, a
+	// content stream and one object per image
+	pageIDs := make([]string, len(pages))
+	next := 3
+	for i, page := range pages {
+		pageIDs[i] = fmt.Sprintf("%d 0 R", next)
+		next += 2 + len(page)
+	}
+
+	p.object(1)
+	p.printf("<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	p.object(2)
+	p.printf("<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(pageIDs, " "), len(pages))
+
+	id := 3
+	for _, page := range pages {
+		pageID, contentID := id, id+1
+		var resources, content strings.Builder
+		for i, placed := range page {
+			fmt.Fprintf(&resources, "/Im%d %d 0 R ", i, contentID+1+i)
+			fmt.Fprintf(&content, "q %s 0 0 %s %s %s cm /Im%d Do Q\n", pdfNumber(placed.w), pdfNumber(placed.h), pdfNumber(placed.x), pdfNumber(placed.y), i)
+		}
+
+		p.object(pageID)
+		p.printf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << %s>> >> /Contents %d 0 R >>\nendobj\n",
+			pdfNumber(width), pdfNumber(height), resources.String(), contentID)
+		p.stream(contentID, "", []byte(content.String()))
+
+		for i, placed := range page {
+			data, err := pdfImageData(placed.img)
+			if err != nil {
+				return err
+			}
+			size := placed.img.Bounds().Size()
+			p.stream(contentID+1+i, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode", size.X, size.Y), data)
+		}
+		id += 2 + len(page)
+	}
+
+	xref := p.offset
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		p.printf("%010d 00000 n \n", offset)
+	}
+	p.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, xref)
+	return p.w.Flush()
+}
+
+// pdfImageData returns the image's pixels as zlib compressed RGB rows, flattened onto white
+func pdfImageData(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	z := zlib.NewWriter(&buf)
+	bounds := img.Bounds()
+	row := make([]byte, 0, 3*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := flattenColor(img.At(x, y), color.White)
+			row = append(row, c.R, c.G, c.B)
+		}
+		if _, err := z.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfNumber formats a length in points with at most two decimals
+func pdfNumber(v float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.2f", v), "0")
+	return strings.TrimSuffix(s, ".")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// presetNamePattern restricts preset names to URL-safe identifiers
+var presetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// maxPresetBodySize bounds the size of a stored preset
+const maxPresetBodySize = 64 * 1024
+
+// presetTokenHeader carries the edit token of PUT and DELETE /presets/:name, and returns
+// it from the PUT that creates a preset
+const presetTokenHeader = "X-Preset-Token"
+
+// presetMu serializes preset writes, so two clients cannot both create the same name
+var presetMu sync.Mutex
+
+// presetKey namespaces preset names inside the shared store
+func presetKey(name string) string {
+	return "preset:" + name
+}
+
+// presetTokenKey is where the hash of a preset's edit token is stored. It is kept apart
+// from the options so GET /presets/:name and preset lookups never see it.
+func presetTokenKey(name string) string {
+	return "preset-token:" + name
+}
+
+// checkPresetToken fails unless the request carries the edit token of the preset, and
+// reports whether the preset exists. A name not taken yet needs no token. Presets stored
+// before edit tokens existed have none and cannot be replaced or deleted.
+func checkPresetToken(c *fiber.Ctx, name string) (bool, error) {
+	hash, err := store.Get(presetTokenKey(name))
+	if errors.Is(err, errNotFound) {
+		_, err = store.Get(presetKey(name))
+		if errors.Is(err, errNotFound) {
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, fiber.NewError(500, "Failed to load preset")
+	}
+	return true, checkEditToken(c, presetTokenHeader, string(hash), "preset")
+}
+
+// loadPreset returns the stored options of a preset
+func loadPreset(name string) (QRCodeOptions, error) {
+	var options QRCodeOptions
+	value, err := store.Get(presetKey(name))
+	if errors.Is(err, errNotFound) {
+		return options, fiber.NewError(404, "Preset not found")
+	}
+	if err != nil {
+		return options, fiber.NewError(500, "Failed to load preset")
+	}
+	if err := json.Unmarshal(value, &options); err != nil {
+		return options, fiber.NewError(500, "Failed to load preset")
+	}
+	return options, nil
+}
+
+// handleSavePreset serves PUT /presets/:name, storing a JSON set of options.
+// Fields left out of the body keep their defaults. Creating a preset answers 201 with its
+// edit token in X-Preset-Token, shown only this once; replacing it requires that token.
+func handleSavePreset(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if !presetNamePattern.MatchString(name) {
+		return fiber.NewError(400, "Preset name must be 1-64 letters, digits, dashes or underscores")
+	}
+
+	options := defaultOptions
+	if err := json.Unmarshal(c.Body(), &options); err != nil {
+		return fiber.NewError(400, "Body must be a JSON object of options")
+	}
+
+	value, err := json.Marshal(options)
+	if err != nil {
+		return fiber.NewError(500, "Failed to save preset")
+	}
+
+	presetMu.Lock()
+	defer presetMu.Unlock()
+	exists, err := checkPresetToken(c, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := store.Save(presetKey(name), value); err != nil {
+			return storeFailure(err, "Failed to save preset")
+		}
+		return c.JSON(options)
+	}
+
+	token, hash, err := newEditToken()
+	if err != nil {
+		return fiber.NewError(500, "Failed to save preset")
+	}
+	if err := store.Save(presetTokenKey(name), []byte(hash)); err != nil {
+		return storeFailure(err, "Failed to save preset")
+	}
+	if err := store.Save(presetKey(name), value); err != nil {
+		store.Delete(presetTokenKey(name))
+		return storeFailure(err, "Failed to save preset")
+	}
+	c.Set(presetTokenHeader, token)
+	return c.Status(201).JSON(options)
+}
+
+// handleGetPreset serves GET /presets/:name
+func handleGetPreset(c *fiber.Ctx) error {
+	options, err := loadPreset(c.Params("name"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(options)
+}
+
+// handleDeletePreset serves DELETE /presets/:name. The request must carry the preset's
+// edit token in X-Preset-Token.
+func handleDeletePreset(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	presetMu.Lock()
+	defer presetMu.Unlock()
+	exists, err := checkPresetToken(c, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fiber.NewError(404, "Preset not found")
+	}
+	err = store.Delete(presetKey(name))
+	if err != nil && !errors.Is(err, errNotFound) {
+		return fiber.NewError(500, "Failed to delete preset")
+	}
+	if err := store.Delete(presetTokenKey(name)); err != nil && !errors.Is(err, errNotFound) {
+		return fiber.NewError(500, "Failed to delete preset")
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPresetsRequireEditToken(t *testing.T) {
+	previous := store
+	store = newMemoryStore(0)
+	defer func() { store = previous }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Put("/presets/:name", handleSavePreset)
+	app.Get("/presets/:name", handleGetPreset)
+	app.Delete("/presets/:name", handleDeletePreset)
+	send := func(method, token, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, "/presets/brand", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(presetTokenHeader, token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get(presetTokenHeader)
+	}
+
+	status, token := send("PUT", "", `{"size":300}`)
+	if status != 201 || token == "" {
+		t.Fatalf("create: status %d, edit token %q", status, token)
+	}
+	for _, tc := range []struct {
+		method, token string
+		want          int
+	}{
+		{"PUT", "", 401},
+		{"PUT", "wrong", 403},
+		{"DELETE", "", 401},
+		{"DELETE", "wrong", 403},
+		{"PUT", token, 200},
+		{"GET", "", 200},
+		{"DELETE", token, 204},
+		{"GET", "", 404},
+		{"DELETE", token, 404},
+	} {
+		if status, _ := send(tc.method, tc.token, `{"size":400}`); status != tc.want {
+			t.Errorf("%s with token %q: status %d, want %d", tc.method, tc.token, status, tc.want)
+		}
+	}
+
+	// Once deleted, the name is free again and gets a new token
+	if status, again := send("PUT", "", `{"size":300}`); status != 201 || again == "" || again == token {
+		t.Errorf("re-create: status %d, edit token %q", status, again)
+	}
+}
+
+func TestPresetStoreFull(t *testing.T) {
+	previous := store
+	store = newMemoryStore(1)
+	defer func() { store = previous }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Put("/presets/:name", handleSavePreset)
+	resp, err := app.Test(httptest.NewRequest("PUT", "/presets/brand", strings.NewReader(`{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 507 {
+		t.Fatalf("status %d, want 507", resp.StatusCode)
+	}
+	// The token saved ahead of the preset is removed again
+	if _, err := store.Get(presetTokenKey("brand")); err == nil {
+		t.Error("edit token left behind by a failed save")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// printChroma approximates the most saturated CIELAB chroma coated offset stock (FOGRA39)
+// reproduces, sampled every 30 degrees of hue from 0 to 360. Screens reach far beyond it
+// for greens, blues and magentas, which print noticeably duller.
+var printChroma = [13]float64{75, 85, 85, 95, 85, 75, 55, 50, 50, 60, 70, 80, 75}
+
+// lab is a CIELAB color under the D65 white point
+type lab struct{ l, a, b float64 }
+
+// toLab converts an 8-bit sRGB color to CIELAB
+func toLab(r, g, b uint8) lab {
+	linear := func(v uint8) float64 {
+		c := float64(v) / 255
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.95047
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// rgb converts the color back to 8-bit sRGB, clipping channels the screen cannot show
+func (c lab) rgb() (r, g, b uint8) {
+	fy := (c.l + 16) / 116
+	fx, fz := fy+c.a/500, fy-c.b/200
+	inv := func(t float64) float64 {
+		if t*t*t > 216.0/24389 {
+			return t * t * t
+		}
+		return (116*t - 16) * 27 / 24389
+	}
+	x, y, z := inv(fx)*0.95047, inv(fy), inv(fz)*1.08883
+
+	channel := func(v float64) uint8 {
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		return uint8(math.Round(math.Min(math.Max(v, 0), 1) * 255))
+	}
+	return channel(3.2406*x - 1.5372*y - 0.4986*z),
+		channel(-0.9689*x + 1.8758*y + 0.0415*z),
+		channel(0.0557*x - 0.2040*y + 1.0570*z)
+}
+
+// maxPrintChroma interpolates printChroma at a hue in degrees
+func maxPrintChroma(hue float64) float64 {
+	pos := math.Mod(hue+360, 360) / 30
+	i := int(pos)
+	return printChroma[i] + (printChroma[i+1]-printChroma[i])*(pos-float64(i))
+}
+
+// printSafeColor pulls a color outside the print gamut in to the most saturated printable
+// color of the same lightness and hue. It reports whether the color had to change.
+func printSafeColor(c color.Color) (color.NRGBA, bool) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	l := toLab(n.R, n.G, n.B)
+	chroma := math.Hypot(l.a, l.b)
+	limit := maxPrintChroma(math.Atan2(l.b, l.a) * 180 / math.Pi)
+	if chroma <= limit {
+		return n, false
+	}
+	scale := limit / chroma
+	n.R, n.G, n.B = lab{l.l, l.a * scale, l.b * scale}.rgb()
+	return n, true
+}
+
+// formatColor writes a color in the rgb() or rgba() syntax lookupColor reads
+func formatColor(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("rgb(%d,%d,%d)", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%d)", c.R, c.G, c.B, c.A)
+}
+
+// isColorOption reports whether the named option holds a single color
+func isColorOption(name string) bool {
+	if rule, ok := optionRules[name]; ok && rule.color {
+		return true
+	}
+	return name == "foreground" || name == "background" || strings.HasSuffix(name, "_color")
+}
+
+// clampPrintColors replaces every color option, palette entry and split color outside the
+// print gamut with its printable equivalent, returning a warning for each change
+func clampPrintColors(options *QRCodeOptions) []string {
+	var warnings []string
+	clamp := func(name, value string) string {
+		c, ok := lookupColor(value)
+		if !ok {
+			return value
+		}
+		safe, changed := printSafeColor(c)
+		if !changed {
+			return value
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %s is outside the print gamut, clamped to %s", name, value, formatColor(safe)))
+		return formatColor(safe)
+	}
+
+	value := reflect.ValueOf(options).Elem()
+	for _, field := range optionFields {
+		if isColorOption(field.name) {
+			v := value.Field(field.index)
+			v.SetString(clamp(field.name, v.String()))
+		}
+	}
+
+	for _, list := range []struct {
+		name  string
+		value *string
+	}{{"palette color", &options.Palette}, {"split_colors color", &options.SplitColors}} {
+		if *list.value == "" {
+			continue
+		}
+		entries := strings.Split(*list.value, ";")
+		for i, entry := range entries {
+			entries[i] = clamp(list.name, strings.TrimSpace(entry))
+		}
+		*list.value = strings.Join(entries, ";")
+	}
+	return warnings
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// windowLimiter counts events per key in fixed windows. Every count is dropped when a
+// window ends, so memory holds only the keys seen in the current one.
+type windowLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	start  time.Time
+	counts map[string]int
+}
+
+func newWindowLimiter(window time.Duration) *windowLimiter {
+	return &windowLimiter{window: window, counts: make(map[string]int)}
+}
+
+// allow counts an event for key and reports whether it stays within limit for the current
+// window. When it does not, it also returns how long until the window ends. A limit of 0
+// or less allows everything.
+func (l *windowLimiter) allow(key string, limit int) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		clear(l.counts)
+	}
+	if l.counts[key] >= limit {
+		return false, l.start.Add(l.window).Sub(now)
+	}
+	l.counts[key]++
+	return true, 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// ringGap is the space in pixels between the QR image and the progress ring
+const ringGap = 6
+
+// applyProgressRing centers the QR code on an enlarged canvas and draws a progress arc
+// around it, starting at the top and running clockwise. The ring circles the whole image,
+// quiet zone included, so modules are never covered.
+func applyProgressRing(img image.Image, bg, ringColor color.Color, percent float64, thickness int) *image.RGBA {
+	qrSize := img.Bounds().Size()
+	inner := math.Hypot(float64(qrSize.X), float64(qrSize.Y))/2 + ringGap
+	radius := inner + float64(thickness)/2
+	side := int(math.Ceil(2 * (inner + float64(thickness) + 1)))
+
+	canvas := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	offset := image.Pt((side-qrSize.X)/2, (side-qrSize.Y)/2)
+	draw.Draw(canvas, image.Rectangle{Min: offset, Max: offset.Add(qrSize)}, img, img.Bounds().Min, draw.Src)
+
+	sweep := math.Min(math.Max(percent, 0), 100) / 100 * 2 * math.Pi
+	center := float64(side) / 2
+	half := float64(thickness) / 2
+
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			dx, dy := float64(x)+0.5-center, float64(y)+0.5-center
+
+			// Angle measured clockwise from 12 o'clock
+			angle := math.Atan2(dx, -dy)
+			if angle < 0 {
+				angle += 2 * math.Pi
+			}
+			if angle > sweep {
+				continue
+			}
+
+			// Anti-alias the inner and outer edges of the stroke
+			coverage := half - math.Abs(math.Hypot(dx, dy)-radius) + 0.5
+			if coverage <= 0 {
+				continue
+			}
+			canvas.Set(x, y, mixColors(canvas.At(x, y), ringColor, math.Min(coverage, 1)))
+		}
+	}
+
+	return canvas
+}
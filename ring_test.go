@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProgressRingDecodes(t *testing.T) {
+	for _, percent := range []float64{25, 75, 100} {
+		options := testOptions("https://example.com/campaign")
+		options.RingPercent = percent
+		options.RingThickness = 12
+		img := renderCode(t, options)
+
+		// The ring enlarges the canvas around the code
+		if img.Bounds().Dx() <= options.Size {
+			t.Errorf("ring_percent=%g: image is %d pixels wide, not enlarged past %d", percent, img.Bounds().Dx(), options.Size)
+		}
+		assertDecodes(t, img, options.Data)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/makiuchi-d/gozxing"
+	gozxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/skip2/go-qrcode"
+)
+
+// safeModulePixels is the narrowest module safe=true accepts, in pixels
+const safeModulePixels = 4
+
+// Readback failures of safe=true, which renderReadable retries with a smaller logo
+var (
+	errNotDecoded   = fiber.NewError(422, "safe: the rendered code does not decode; shrink the logo or drop decorations over the modules")
+	errDecodedWrong = fiber.NewError(422, "safe: the rendered code decodes to different data")
+)
+
+// logoShrinkRetries caps how often renderReadable renders again with a smaller logo. Each
+// retry is a full render that downloads its images again, so the cap stays low.
+const logoShrinkRetries = 3
+
+// logoShrinkFactor scales logo_size on each retry
+const logoShrinkFactor = 0.75
+
+// minShrunkLogoSize is the smallest logo_size a retry tries
+const minShrunkLogoSize = 5
+
+// applySafeMode turns on the guards safe=true adds to the options, returning a warning
+// for each option it changes:
+//   - gradient_autocontrast, so gradient stops stay readable against the background
+//   - logo_autofit, so a logo hides no more than the error correction can restore
+//   - error raised to H when there is a logo
+//
+// The remaining guards run later: checkSafeOptions rejects low contrast and small
+// modules, checkReadback decodes the finished image, and renderReadable renders again
+// with a smaller logo when that fails.
+func applySafeMode(options *QRCodeOptions) []string {
+	var warnings []string
+	if (options.GradientStart != "" || options.GradientEnd != "") && !options.GradientAutoContrast {
+		warnings = append(warnings, "safe turned on gradient_autocontrast")
+		options.GradientAutoContrast = true
+	}
+	if options.LogoURL != "" {
+		if options.Error != "H" {
+			warnings = append(warnings, fmt.Sprintf("safe raised error from %s to H for the logo", options.Error))
+			options.Error = "H"
+		}
+		if !options.LogoAutofit {
+			warnings = append(warnings, "safe turned on logo_autofit, replacing logo_size")
+			options.LogoAutofit = true
+		}
+	}
+	return warnings
+}
+
+// checkSafeOptions rejects options safe=true does not accept with 422: module colors too
+// close to the background, and modules narrower than safeModulePixels
+func checkSafeOptions(qr *qrcode.QRCode, options QRCodeOptions) error {
+	if ratio := contrastRatio(parseColor(options.Foreground), parseColor(options.Background)); ratio < minModuleContrast {
+		return fiber.NewError(422, fmt.Sprintf("safe: foreground has a contrast of %.1f:1 with the background, below %g:1", ratio, minModuleContrast))
+	}
+	if pixels := modulePixels(qr, options); pixels < safeModulePixels {
+		need := int(math.Ceil(float64(max(options.Size, 1)) * safeModulePixels / pixels))
+		return fiber.NewError(422, fmt.Sprintf("safe: modules are %.1f pixels wide, below %d; raise size to at least %d", pixels, safeModulePixels, need))
+	}
+	return nil
+}
+
+// overWhite returns the luminance of a color composited over white, as printed or shown
+// on a light page
+func overWhite(c color.Color) float64 {
+	r, g, b, a := c.RGBA()
+	over := func(v uint32) uint8 { return uint8((v + (0xffff - a)) >> 8) }
+	return relativeLuminance(color.RGBA{R: over(r), G: over(g), B: over(b), A: 255})
+}
+
+// decodeImage reads the code in img with an independent decoder, returning the raw bytes
+// of its byte segments, or its text when it has none. Transparency is flattened onto
+// white, as on a page.
+func decodeImage(img image.Image) ([]byte, error) {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	source := gozxing.NewLuminanceSourceFromImage(flat)
+	bitmap, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+	if err != nil {
+		return nil, err
+	}
+	// The detector estimates the module pitch from the finder patterns, which uneven module
+	// widths can throw off; the pure barcode path measures undecorated codes directly instead
+	reader := gozxingqr.NewQRCodeReader()
+	result, err := reader.Decode(bitmap, map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true})
+	if err != nil {
+		result, err = reader.Decode(bitmap, map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_PURE_BARCODE: true})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if segments, ok := result.GetResultMetadata()[gozxing.ResultMetadataType_BYTE_SEGMENTS].([][]byte); ok {
+		var raw []byte
+		for _, segment := range segments {
+			raw = append(raw, segment...)
+		}
+		return raw, nil
+	}
+	return []byte(result.GetText()), nil
+}
+
+// checkReadback decodes the finished image as a scanner would and rejects it with 422
+// unless it reads back as data. This catches whatever stops a scan: finder patterns lost
+// to decorations, low contrast after a background image, more damaged codewords than the
+// error correction restores. A single decoder reading the code does not mean every phone
+// camera will, so the other guards still apply.
+func checkReadback(img image.Image, data string) error {
+	decoded, err := decodeImage(img)
+	if err != nil {
+		return errNotDecoded
+	}
+	if string(decoded) != data {
+		return errDecodedWrong
+	}
+	return nil
+}
+
+// renderReadable renders the code like generateImage. When safe=true rejects the result
+// because it does not read back and there is a logo, it renders again with logo_size
+// shrunk by logoShrinkFactor, at most logoShrinkRetries times and never below
+// minShrunkLogoSize. It reports the logo_size of the returned image, which differs from
+// options.LogoSize only after a retry.
+func renderReadable(options QRCodeOptions, timer *stageTimer, report *renderReport) (image.Image, float64, []string, error) {
+	img, warnings, err := generateImage(options, timer, report)
+	for retry := 0; retry < logoShrinkRetries && options.LogoURL != "" && (errors.Is(err, errNotDecoded) || errors.Is(err, errDecodedWrong)); retry++ {
+		size := math.Round(options.LogoSize*logoShrinkFactor*10) / 10
+		if size < minShrunkLogoSize {
+			break
+		}
+		options.LogoSize = size
+		img, warnings, err = generateImage(options, timer, report)
+		if err == nil {
+			warnings = append(warnings, fmt.Sprintf("safe shrank logo_size to %g so the code decodes", size))
+		}
+	}
+	return img, options.LogoSize, warnings, err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// safeRender prepares options with safe=true and renders them as PNG
+func safeRender(t *testing.T, options QRCodeOptions) error {
+	t.Helper()
+	options.Safe = true
+	if _, err := prepareOptions(&options); err != nil {
+		t.Fatalf("prepareOptions: %v", err)
+	}
+	_, _, err := renderOutput(options, nil)
+	return err
+}
+
+// solidImage returns a w x h image filled with c
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestSafeModeAcceptsScannableCodes(t *testing.T) {
+	plain := testOptions("https://example.com/safe")
+	if err := safeRender(t, plain); err != nil {
+		t.Errorf("plain code: %v", err)
+	}
+
+	// safe raises the error level and fits the logo, so even a large one stays readable
+	logo := testOptions("https://example.com/safe")
+	logo.LogoURL = serveImage(t, solidImage(64, 64, color.NRGBA{R: 200, A: 255}))
+	logo.LogoSize = 40
+	if err := safeRender(t, logo); err != nil {
+		t.Errorf("code with a logo: %v", err)
+	}
+}
+
+func TestSafeModeRejectsUnreadableCodes(t *testing.T) {
+	// A white tile on every dark module leaves only the finder patterns
+	options := testOptions("https://example.com/safe")
+	options.ModuleImageURL = serveImage(t, solidImage(8, 8, color.White))
+	err := safeRender(t, options)
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) || fiberErr.Code != 422 {
+		t.Fatalf("render = %v, want a 422", err)
+	}
+
+	// The same code renders without safe
+	options.Safe = false
+	if _, err := prepareOptions(&options); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := renderOutput(options, nil); err != nil {
+		t.Errorf("without safe: %v", err)
+	}
+}
+
+func TestCheckReadback(t *testing.T) {
+	options := testOptions("https://example.com/safe")
+	img := renderCode(t, options)
+	if err := checkReadback(img, options.Data); err != nil {
+		t.Errorf("rendered code: %v", err)
+	}
+	if err := checkReadback(img, "https://example.com/other"); err == nil {
+		t.Error("a code for other data passed")
+	}
+	if err := checkReadback(solidImage(300, 300, color.White), options.Data); err == nil {
+		t.Error("a blank image passed")
+	}
+}
+
+func TestSafeModeShrinksLogoUntilReadable(t *testing.T) {
+	// A logo this large at error level M hides more than the error correction restores
+	options := testOptions("https://example.com/safe")
+	options.Safe = true
+	options.Error = "M"
+	options.LogoURL = serveImage(t, solidImage(64, 64, color.NRGBA{R: 200, A: 255}))
+	options.LogoSize = 30
+	if err := checkReadback(renderCode(t, withoutSafe(options)), options.Data); err == nil {
+		t.Fatal("the full size logo decodes, so nothing is left to shrink")
+	}
+
+	img, size, warnings, err := renderReadable(options, nil, nil)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if size >= options.LogoSize || size < minShrunkLogoSize {
+		t.Errorf("logo_size %g after shrinking from %g", size, options.LogoSize)
+	}
+	if !slices.Contains(warnings, fmt.Sprintf("safe shrank logo_size to %g so the code decodes", size)) {
+		t.Errorf("warnings %q do not report the shrink", warnings)
+	}
+	assertDecodes(t, img, options.Data)
+
+	// The retries are capped, so a logo too large to save still fails
+	options.LogoSize = 60
+	if _, _, _, err := renderReadable(options, nil, nil); !errors.Is(err, errNotDecoded) && !errors.Is(err, errDecodedWrong) {
+		t.Errorf("render with logo_size 60 = %v, want a readback failure", err)
+	}
+}
+
+// withoutSafe returns the options with safe=false
+func withoutSafe(options QRCodeOptions) QRCodeOptions {
+	options.Safe = false
+	return options
+}
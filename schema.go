@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// optionRule constrains the values of one option. The same rules drive validateOptions
+// and the /schema description, so clients building forms see what the server enforces.
+type optionRule struct {
+	enum     []string // allowed values; options whose default is "" may also be left out
+	min, max float64  // inclusive range for numeric options, checked when ranged is set
+	ranged   bool
+	color    bool // must be a recognized color when set
+}
+
+// atLeast constrains a numeric option to min and above
+func atLeast(min float64) optionRule {
+	return optionRule{min: min, max: math.Inf(1), ranged: true}
+}
+
+// between constrains a numeric option to the inclusive range min..max
+func between(min, max float64) optionRule {
+	return optionRule{min: min, max: max, ranged: true}
+}
+
+// oneOf constrains a string option to the listed values
+func oneOf(values ...string) optionRule {
+	return optionRule{enum: values}
+}
+
+// colorRule requires a string option to be a recognized color
+var colorRule = optionRule{color: true}
+
+// optionRules holds the enum, range and color constraints by option name
+var optionRules = map[string]optionRule{
+	"type":          oneOf("crypto"),
+	"data_encoding": oneOf("text", "base64"),
+	"size":          between(1, 4096),
+	"error":         oneOf("L", "M", "Q", "H"),
+	"encoding_mode": oneOf("numeric", "alphanumeric", "byte", "auto"),
+	"border":        between(0, 100),
+	"foreground":    colorRule,
+	"background":    colorRule,
+
+	"frame_style": oneOf("dotted", "dashed"),
+	"frame_color": colorRule,
+	"frame_dash":  between(2, 100),
+
+	"border_radius":       atLeast(0),
+	"border_top":          between(-1, 100),
+	"border_right":        between(-1, 100),
+	"border_bottom":       between(-1, 100),
+	"border_left":         between(-1, 100),
+	"border_top_color":    colorRule,
+	"border_right_color":  colorRule,
+	"border_bottom_color": colorRule,
+	"border_left_color":   colorRule,
+
+	"bleed":       between(0, 1000),
+	"bleed_color": colorRule,
+
+	"logo_size":      between(0, 60),
+	"logo_tint":      colorRule,
+	"logo_tint_mode": oneOf("fill", "multiply"),
+	"logo_plate":     oneOf("box", "silhouette"),
+	"logo_padding":   between(0, 100),
+	"logo_blend":     between(0, 1),
+
+	"gradient_start":    colorRule,
+	"gradient_end":      colorRule,
+	"gradient_type":     oneOf("linear", "radial"),
+	"gradient_angle":    between(-360, 360),
+	"gradient_fallback": colorRule,
+
+	"module_jitter":  between(0, 1),
+	"module_gap":     between(0, maxModuleGap),
+	"module_quality": oneOf("fast", "balanced", "best"),
+
+	"logo_mask_size": between(1, 60),
+
+	"eye_outer_shape": oneOf("square", "rounded", "circle"),
+	"eye_inner_shape": oneOf("square", "rounded", "circle"),
+	"eye_outer_color": colorRule,
+	"eye_inner_color": colorRule,
+
+	"background_fit":   oneOf("cover", "contain", "stretch"),
+	"background_align": oneOf("center", "top", "bottom", "left", "right", "top-left", "top-right", "bottom-left", "bottom-right"),
+
+	"background_pattern": oneOf("dots", "grid", "stripes"),
+	"pattern_color":      colorRule,
+	"vignette_color":     colorRule,
+
+	"currency": oneOf("bitcoin", "bitcoincash", "dogecoin", "ethereum", "litecoin", "monero"),
+
+	"shape":        oneOf("circle", "rounded"),
+	"image_radius": atLeast(0),
+
+	"layout":              oneOf("circular"),
+	"layout_fill":         oneOf("background", "modules"),
+	"layout_border":       between(0, 100),
+	"layout_border_color": colorRule,
+
+	"ring_percent":   between(0, 100),
+	"ring_thickness": between(1, 100),
+	"ring_color":     colorRule,
+
+	"card_radius":  atLeast(0),
+	"card_padding": between(0, 256),
+	"card_color":   colorRule,
+
+	"label_size":    between(6, 200),
+	"label_dir":     oneOf("auto", "ltr", "rtl"),
+	"label_color":   colorRule,
+	"caption_font":  oneOf(bundledFontNames()...),
+	"show_text_max": between(2, 500),
+
+	"format":        oneOf("png", "jpeg", "ico", "html", "svg", "ansi", "css", "json-matrix", "lottie", "gocode"),
+	"cell_size":     between(1, 20),
+	"quality":       between(1, 100),
+	"max_bytes":     atLeast(0),
+	"orientation":   between(0, 8),
+	"dpi":           between(0, 2400),
+	"min_module_mm": between(0, 10),
+}
+
+// optionField is a client-facing field of QRCodeOptions
+type optionField struct {
+	name  string
+	index int
+}
+
+// optionFields lists the client-facing fields of QRCodeOptions in declaration order
+var optionFields = func() []optionField {
+	var fields []optionField
+	t := reflect.TypeOf(QRCodeOptions{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if t.Field(i).IsExported() && name != "" && name != "-" {
+			fields = append(fields, optionField{name: name, index: i})
+		}
+	}
+	return fields
+}()
+
+// checkOptionRules validates the options against optionRules, in field order
+func checkOptionRules(options *QRCodeOptions) error {
+	value := reflect.ValueOf(options).Elem()
+	defaults := reflect.ValueOf(defaultOptions)
+	for _, field := range optionFields {
+		rule, ok := optionRules[field.name]
+		if !ok {
+			continue
+		}
+		v := value.Field(field.index)
+
+		switch {
+		case rule.enum != nil:
+			s := v.String()
+			if s == "" && defaults.Field(field.index).String() == "" {
+				continue
+			}
+			if !slices.Contains(rule.enum, s) {
+				return fiber.NewError(400, fmt.Sprintf("%s must be one of %s", field.name, strings.Join(rule.enum, ", ")))
+			}
+		case rule.color:
+			if _, ok := lookupColor(v.String()); v.String() != "" && !ok {
+				return fiber.NewError(400, fmt.Sprintf("%s is not a valid color: %q", field.name, v.String()))
+			}
+		case rule.ranged:
+			var n float64
+			if v.CanInt() {
+				n = float64(v.Int())
+			} else {
+				n = v.Float()
+			}
+			if !rule.allows(n) {
+				return fiber.NewError(400, rule.message(field.name))
+			}
+		}
+	}
+	return nil
+}
+
+// allows reports whether n falls in the range of a ranged rule; NaN never does
+func (r optionRule) allows(n float64) bool {
+	return n >= r.min && n <= r.max
+}
+
+// message describes the range the option must fall in
+func (r optionRule) message(name string) string {
+	switch {
+	case math.IsInf(r.max, 1) && r.min == 0:
+		return name + " must not be negative"
+	case math.IsInf(r.max, 1):
+		return fmt.Sprintf("%s must be at least %g", name, r.min)
+	default:
+		return fmt.Sprintf("%s must be between %g and %g", name, r.min, r.max)
+	}
+}
+
+// schemaType maps a Go field kind to its JSON schema type
+func schemaType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// optionSchema describes every option with its type, default and constraints
+func optionSchema() []fiber.Map {
+	defaults := reflect.ValueOf(defaultOptions)
+	schema := make([]fiber.Map, 0, len(optionFields))
+	for _, field := range optionFields {
+		v := defaults.Field(field.index)
+		entry := fiber.Map{"name": field.name, "type": schemaType(v.Kind()), "default": v.Interface()}
+		for alias, name := range queryAliases {
+			if name == field.name {
+				entry["alias"] = alias
+			}
+		}
+
+		rule := optionRules[field.name]
+		switch {
+		case rule.enum != nil:
+			entry["enum"] = rule.enum
+		case rule.color:
+			entry["format"] = "color"
+		case rule.ranged:
+			entry["minimum"] = rule.min
+			if !math.IsInf(rule.max, 1) {
+				entry["maximum"] = rule.max
+			}
+		}
+
+		// The operator's allowlists narrow the accepted values
+		if field.name == "size" && len(config.AllowedSizes) > 0 {
+			entry["enum"] = config.AllowedSizes
+		}
+		if field.name == "format" && len(config.AllowedFormats) > 0 {
+			entry["enum"] = config.AllowedFormats
+		}
+		schema = append(schema, entry)
+	}
+	return schema
+}
+
+// handleSchema serves GET /schema
+func handleSchema(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"options": optionSchema()})
+}
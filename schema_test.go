@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColorOptionsRejectUnknownColors(t *testing.T) {
+	for _, field := range optionFields {
+		plain := field.name == "foreground" || field.name == "background" || field.name == "logo_tint" ||
+			strings.HasSuffix(field.name, "_color")
+		if !plain {
+			continue
+		}
+		if !optionRules[field.name].color {
+			t.Errorf("%s has no color rule", field.name)
+			continue
+		}
+		options := testOptions("hello")
+		reflect.ValueOf(&options).Elem().Field(field.index).SetString("not-a-color")
+		if err := checkOptionRules(&options); err == nil {
+			t.Errorf("%s=not-a-color passed validation", field.name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// roundedRectMask builds an anti-aliased alpha mask of a w x h rectangle with rounded corners
+func roundedRectMask(w, h, radius int) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	r := float64(radius)
+	if max := float64(min(w, h)) / 2; r > max {
+		r = max
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Distance from the pixel center to the nearest corner circle center
+			px, py := float64(x)+0.5, float64(y)+0.5
+			cx := math.Min(math.Max(px, r), float64(w)-r)
+			cy := math.Min(math.Max(py, r), float64(h)-r)
+			coverage := r - math.Hypot(px-cx, py-cy) + 0.5
+			if r == 0 {
+				// Without corners every pixel is inside, where the formula gives half coverage
+				coverage = 1
+			}
+			mask.SetAlpha(x, y, color.Alpha{A: uint8(math.Min(math.Max(coverage, 0), 1) * 255)})
+		}
+	}
+
+	return mask
+}
+
+// circleMask builds an anti-aliased alpha mask of the largest circle centered in a w x h area
+func circleMask(w, h int) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	cx, cy := float64(w)/2, float64(h)/2
+	r := math.Min(cx, cy)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			coverage := r - math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) + 0.5
+			mask.SetAlpha(x, y, color.Alpha{A: uint8(math.Min(math.Max(coverage, 0), 1) * 255)})
+		}
+	}
+
+	return mask
+}
+
+// applyMask returns img with everything outside the mask made transparent
+func applyMask(img image.Image, mask *image.Alpha) *image.RGBA {
+	result := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.DrawMask(result, result.Bounds(), img, img.Bounds().Min, mask, image.Point{}, draw.Src)
+	return result
+}
+
+// masksModules reports whether the mask cuts into any corner of the module area
+func masksModules(mask *image.Alpha, modules image.Rectangle) bool {
+	corners := []image.Point{
+		modules.Min,
+		{X: modules.Max.X - 1, Y: modules.Min.Y},
+		{X: modules.Min.X, Y: modules.Max.Y - 1},
+		{X: modules.Max.X - 1, Y: modules.Max.Y - 1},
+	}
+	for _, p := range corners {
+		if mask.AlphaAt(p.X, p.Y).A < 255 {
+			return true
+		}
+	}
+	return false
+}
+
+// maxBorderRadius returns the largest corner radius for a size image whose rounded corners
+// stay clear of the modules rectangle. A corner arc of radius r cuts r(1-1/√2) pixels deep
+// along the diagonal, so the radius is bounded by the thinnest margin at any corner.
+func maxBorderRadius(size image.Point, modules image.Rectangle) int {
+	margin := min(modules.Min.X, modules.Min.Y, size.X-modules.Max.X, size.Y-modules.Max.Y)
+	if margin <= 0 {
+		return 0
+	}
+	return int(float64(margin) / (1 - 1/math.Sqrt2))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShapeDecodesAtDefaultBorder(t *testing.T) {
+	for _, shape := range []string{"circle", "rounded"} {
+		t.Run(shape, func(t *testing.T) {
+			options := testOptions("https://example.com/badge")
+			options.Shape = shape
+			img := renderCode(t, options)
+
+			// The corners outside the outline are cleared
+			if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+				t.Errorf("corner alpha = %d, want transparent", a)
+			}
+			assertDecodes(t, img, options.Data)
+		})
+	}
+}
+
+func TestShapeWarnsWhenClippingModules(t *testing.T) {
+	options := testOptions("https://example.com/badge")
+	options.Shape = "circle"
+	options.Border = 1
+	if _, err := prepareOptions(&options); err != nil {
+		t.Fatal(err)
+	}
+	_, warnings, err := generateImage(options, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) == 0 {
+		t.Error("no warning for a circle clipping the modules at border=1")
+	}
+}
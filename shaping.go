@@ -0,0 +1,194 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"slices"
+	"sync"
+
+	"github.com/go-text/typesetting/bidi"
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// textShaper lays out caption lines with HarfBuzz shaping, so joined scripts such as
+// Arabic get their contextual forms and combining marks sit on their base letters.
+// Shapers and faces cache state that is not safe for concurrent use, so each render
+// takes one from the shapers pool.
+type textShaper struct {
+	harfbuzz  shaping.HarfbuzzShaper
+	segmenter shaping.Segmenter
+	faces     map[*font.Font]*font.Face
+}
+
+// shapers holds idle text shapers
+var shapers = sync.Pool{New: func() any {
+	return &textShaper{faces: make(map[*font.Font]*font.Face)}
+}}
+
+// faceChain resolves every character to the first face with a glyph for it, or the first face
+type faceChain []*font.Face
+
+func (c faceChain) ResolveFace(r rune) *font.Face {
+	for _, face := range c {
+		if _, ok := face.NominalGlyph(r); ok {
+			return face
+		}
+	}
+	return c[0]
+}
+
+// maxShaperFaces bounds the faces a shaper keeps; downloaded caption fonts come and go
+const maxShaperFaces = 64
+
+// face returns the shaper's face for a parsed font
+func (s *textShaper) face(f *font.Font) *font.Face {
+	face, ok := s.faces[f]
+	if !ok {
+		if len(s.faces) >= maxShaperFaces {
+			clear(s.faces)
+		}
+		face = font.NewFace(f)
+		s.faces[f] = face
+	}
+	return face
+}
+
+// shapedLine is a caption line laid out in visual order, left to right
+type shapedLine struct {
+	runs            []shaping.Output
+	width           fixed.Int26_6
+	ascent, descent fixed.Int26_6 // of the caption's first font, both positive
+}
+
+// shape splits the line into runs of one direction, script and font, shapes each and
+// orders them for display
+func (s *textShaper) shape(line caption, size float64) shapedLine {
+	chain := make(faceChain, len(line.fonts))
+	for i, f := range line.fonts {
+		chain[i] = s.face(f)
+	}
+
+	direction := di.DirectionLTR
+	if line.rtl {
+		direction = di.DirectionRTL
+	}
+	text := []rune(line.text)
+	input := shaping.Input{Text: text, RunEnd: len(text), Direction: direction, Size: fixed.Int26_6(size * 64)}
+
+	var shaped shapedLine
+	for _, run := range s.segmenter.Split(input, chain) {
+		out := s.harfbuzz.Shape(run)
+		shaped.runs = append(shaped.runs, out)
+		shaped.width += out.Advance
+	}
+	visualOrder(shaped.runs, line.rtl)
+
+	if extents, ok := chain[0].FontHExtents(); ok {
+		scale := float32(size) / float32(chain[0].Upem())
+		shaped.ascent = fixed.Int26_6(extents.Ascender * scale * 64)
+		shaped.descent = fixed.Int26_6(-extents.Descender * scale * 64)
+	}
+	return shaped
+}
+
+// visualOrder reorders runs from logical to display order. Runs arrive in reading order,
+// and each run's glyphs are already in display order. An RTL paragraph reverses the runs,
+// and embedded runs against the paragraph direction, such as a brand name in a Hebrew
+// label, are reversed back into their own reading order.
+func visualOrder(runs []shaping.Output, rtl bool) {
+	if rtl {
+		slices.Reverse(runs)
+	}
+	against := func(run shaping.Output) bool {
+		return (run.Direction.Progression() == di.TowardTopLeft) != rtl
+	}
+	for i := 0; i < len(runs); {
+		if !against(runs[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runs) && against(runs[j]) {
+			j++
+		}
+		slices.Reverse(runs[i:j])
+		i = j
+	}
+}
+
+// rasterize draws the glyph outlines into a width x height coverage mask, starting at x on the baseline
+func (l shapedLine) rasterize(width, height int, x, baseline float32) *image.Alpha {
+	r := vector.NewRasterizer(width, height)
+	r.DrawOp = draw.Src
+	dot := x
+	for _, run := range l.runs {
+		scale := float32(run.Size) / 64 / float32(run.Face.Upem())
+		for _, glyph := range run.Glyphs {
+			gx := dot + float32(glyph.XOffset)/64
+			gy := baseline - float32(glyph.YOffset)/64
+			if outline, ok := run.Face.GlyphData(glyph.GlyphID).(font.GlyphOutline); ok {
+				addOutline(r, outline, gx, gy, scale)
+			}
+			dot += float32(glyph.Advance) / 64
+		}
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	r.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return mask
+}
+
+// addOutline adds a glyph outline, given in font units with y up, to the rasterizer
+func addOutline(r *vector.Rasterizer, outline font.GlyphOutline, x, y, scale float32) {
+	px := func(p ot.SegmentPoint) float32 { return x + p.X*scale }
+	py := func(p ot.SegmentPoint) float32 { return y - p.Y*scale }
+	started := false
+	for _, segment := range outline.Segments {
+		a := segment.Args
+		switch segment.Op {
+		case ot.SegmentOpMoveTo:
+			if started {
+				r.ClosePath()
+			}
+			r.MoveTo(px(a[0]), py(a[0]))
+			started = true
+		case ot.SegmentOpLineTo:
+			r.LineTo(px(a[0]), py(a[0]))
+		case ot.SegmentOpQuadTo:
+			r.QuadTo(px(a[0]), py(a[0]), px(a[1]), py(a[1]))
+		case ot.SegmentOpCubeTo:
+			r.CubeTo(px(a[0]), py(a[0]), px(a[1]), py(a[1]), px(a[2]), py(a[2]))
+		}
+	}
+	if started {
+		r.ClosePath()
+	}
+}
+
+// isRightToLeft resolves label_dir for a line of text. "auto" follows the first strong
+// character, per the Unicode bidi algorithm, so a Hebrew or Arabic label reads right to left.
+func isRightToLeft(text, dir string) bool {
+	switch dir {
+	case "rtl":
+		return true
+	case "ltr":
+		return false
+	}
+	var paragraph bidi.Paragraph
+	runs := paragraph.SegmentString(text, bidi.Neutral)
+	if runs.NumRuns() == 0 {
+		return false
+	}
+	// The paragraph level is the lowest run level, which is odd for RTL paragraphs
+	for i := 0; i < runs.NumRuns(); i++ {
+		if runs.Run(i).Level == 0 {
+			return false
+		}
+	}
+	return true
+}
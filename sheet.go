@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxSheetItems bounds the number of codes laid out by one sheet request
+const maxSheetItems = 256
+
+// labelPadding keeps codes clear of the die cut, in points
+const labelPadding = 4.5
+
+// labelStock describes a sheet of die-cut labels. Lengths are in points (1/72 inch).
+type labelStock struct {
+	pageWidth, pageHeight   float64
+	labelWidth, labelHeight float64
+	columns, rows           int
+	top, left               float64 // page margins to the first label
+	gapX, gapY              float64 // space between neighboring labels
+}
+
+// inches converts inches to points
+func inches(v float64) float64 { return v * 72 }
+
+// millimeters converts millimeters to points
+func millimeters(v float64) float64 { return v * 72 / 25.4 }
+
+// labelStocks maps stock names to their layouts
+var labelStocks = map[string]labelStock{
+	// US Letter
+	"avery-5160": {inches(8.5), inches(11), inches(2.625), inches(1), 3, 10, inches(0.5), inches(0.1875), inches(0.125), 0},
+	"avery-5163": {inches(8.5), inches(11), inches(4), inches(2), 2, 5, inches(0.5), inches(0.15625), inches(0.1875), 0},
+	"avery-5164": {inches(8.5), inches(11), inches(4), inches(10.0 / 3), 2, 3, inches(0.5), inches(0.15625), inches(0.1875), 0},
+	// A4
+	"avery-l7160": {millimeters(210), millimeters(297), millimeters(63.5), millimeters(38.1), 3, 7, millimeters(15.15), millimeters(7.25), millimeters(2.5), 0},
+	"avery-l7163": {millimeters(210), millimeters(297), millimeters(99.1), millimeters(38.1), 2, 7, millimeters(15.15), millimeters(4.65), millimeters(2.5), 0},
+}
+
+// perSheet returns the number of labels on one sheet
+func (s labelStock) perSheet() int {
+	return s.columns * s.rows
+}
+
+// label returns the top-left corner of label i on its sheet, in points from the top-left of the page
+func (s labelStock) label(i int) (x, y float64) {
+	i %= s.perSheet()
+	x = s.left + float64(i%s.columns)*(s.labelWidth+s.gapX)
+	y = s.top + float64(i/s.columns)*(s.labelHeight+s.gapY)
+	return x, y
+}
+
+// codeSide returns the side in points of the square code centered on each label
+func (s labelStock) codeSide() float64 {
+	return math.Min(s.labelWidth, s.labelHeight) - 2*labelPadding
+}
+
+// sheetRequest is the body of POST /generate/sheet. Options are shared by every code,
+// and data holds one entry per label, filled row by row.
+type sheetRequest struct {
+	Stock   string          `json:"stock"`
+	Options json.RawMessage `json:"options"`
+	Data    []string        `json:"data"`
+	Format  string          `json:"format"` // "pdf" or "png"
+	DPI     int             `json:"dpi"`    // resolution codes are rendered at
+}
+
+// handleSheet serves POST /generate/sheet, laying codes out on a named label stock as
+// a PDF with one page per sheet, or as a PNG of a single sheet
+func handleSheet(c *fiber.Ctx) error {
+	req := sheetRequest{Format: "pdf", DPI: 300}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(400, "Body must be a JSON sheet request")
+	}
+
+	stock, ok := labelStocks[req.Stock]
+	if !ok {
+		return fiber.NewError(400, "stock must be one of "+strings.Join(slices.Sorted(maps.Keys(labelStocks)), ", "))
+	}
+	if len(req.Data) == 0 || len(req.Data) > maxSheetItems {
+		return fiber.NewError(400, fmt.Sprintf("data must contain between 1 and %d entries", maxSheetItems))
+	}
+	if req.Format != "pdf" && req.Format != "png" {
+		return fiber.NewError(400, "format must be one of pdf, png")
+	}
+	if req.DPI < 72 || req.DPI > 600 {
+		return fiber.NewError(400, "dpi must be between 72 and 600")
+	}
+	sheets := (len(req.Data) + stock.perSheet() - 1) / stock.perSheet()
+	if req.Format == "png" && sheets > 1 {
+		return fiber.NewError(400, fmt.Sprintf("%d codes need %d sheets of %s; use format=pdf for more than one", len(req.Data), sheets, req.Stock))
+	}
+
+	// Render every code at the print resolution of its box through the batch pipeline
+	scale := float64(req.DPI) / 72
+	cellSize := int(stock.codeSide() * scale)
+	raw := make([]json.RawMessage, len(req.Data))
+	for i, data := range req.Data {
+		raw[i], _ = json.Marshal(struct {
+			Data string `json:"data"`
+		}{data})
+	}
+	items, err := decodeItems(c, req.Options, raw, cellSize)
+	if err != nil {
+		return err
+	}
+	images, err := generateItems(items)
+	if err != nil {
+		return err
+	}
+	for i, img := range images {
+		// Decorations such as rings or cards enlarge the image, so fit it back into the box
+		if img.Bounds().Dx() > cellSize || img.Bounds().Dy() > cellSize {
+			images[i] = imaging.Fit(img, cellSize, cellSize, imaging.Lanczos)
+		}
+	}
+
+	c.Set("X-QR-Sheet-Columns", strconv.Itoa(stock.columns))
+	c.Set("X-QR-Sheet-Rows", strconv.Itoa(stock.rows))
+	c.Set("X-QR-Sheet-Pages", strconv.Itoa(sheets))
+	c.Set("X-QR-Cell-Size", strconv.Itoa(cellSize))
+
+	var buf bytes.Buffer
+	if req.Format == "png" {
+		if err := png.Encode(&buf, rasterSheet(stock, images, scale)); err != nil {
+			return fiber.NewError(500, "Failed to encode sticker sheet")
+		}
+		// Tag the sheet with its resolution so it prints at the size of the stock
+		body, err := withPNGResolution(buf.Bytes(), req.DPI)
+		if err != nil {
+			return fiber.NewError(500, "Failed to encode sticker sheet")
+		}
+		c.Set("Content-Type", "image/png")
+		return c.Send(body)
+	}
+
+	pages := make([][]pdfImage, sheets)
+	for i, img := range images {
+		x, y := stock.label(i)
+		side := stock.codeSide()
+		size := img.Bounds().Size()
+		w, h := side*float64(size.X)/float64(cellSize), side*float64(size.Y)/float64(cellSize)
+		// PDF measures from the bottom of the page
+		left := x + (stock.labelWidth-w)/2
+		bottom := stock.pageHeight - y - (stock.labelHeight+h)/2
+		pages[i/stock.perSheet()] = append(pages[i/stock.perSheet()], pdfImage{img, left, bottom, w, h})
+	}
+	if err := writePDF(&buf, stock.pageWidth, stock.pageHeight, pages); err != nil {
+		return fiber.NewError(500, "Failed to encode sticker sheet")
+	}
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", `attachment; filename="sheet.pdf"`)
+	return c.Send(buf.Bytes())
+}
+
+// rasterSheet draws the codes centered on their labels on a white sheet at the given pixels per point
+func rasterSheet(stock labelStock, images []image.Image, scale float64) *image.RGBA {
+	sheet := image.NewRGBA(image.Rect(0, 0, int(math.Round(stock.pageWidth*scale)), int(math.Round(stock.pageHeight*scale))))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, img := range images {
+		x, y := stock.label(i)
+		size := img.Bounds().Size()
+		left := int(math.Round((x+stock.labelWidth/2)*scale)) - size.X/2
+		top := int(math.Round((y+stock.labelHeight/2)*scale)) - size.Y/2
+		draw.Draw(sheet, image.Rect(left, top, left+size.X, top+size.Y), img, img.Bounds().Min, draw.Over)
+	}
+	return sheet
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// parseSplitColors parses the two semicolon separated split_colors, reporting false unless
+// there are exactly two recognized colors
+func parseSplitColors(list string) (first, second color.Color, ok bool) {
+	parts := strings.Split(list, ";")
+	if len(parts) != 2 {
+		return nil, nil, false
+	}
+	first, okFirst := lookupColor(strings.TrimSpace(parts[0]))
+	second, okSecond := lookupColor(strings.TrimSpace(parts[1]))
+	return first, second, okFirst && okSecond
+}
+
+// applySplitColors recolors each dark module by the side of a line through the center of
+// the code it lies on. The line runs at angle degrees clockwise from horizontal, and
+// modules above it take the first color. Finder patterns all take the first color so the
+// code stays easy to locate.
+func applySplitColors(img image.Image, bitmap [][]bool, quietZone int, fg, first, second color.Color, angle float64) *image.RGBA {
+	modules := len(bitmap)
+	symbol := modules - 2*quietZone
+	normalX, normalY := -math.Sin(angle*math.Pi/180), math.Cos(angle*math.Pi/180)
+
+	// Decide the side from the module center so every module is a single color
+	colors := make([][]color.Color, modules)
+	for my := range colors {
+		colors[my] = make([]color.Color, modules)
+		for mx := range colors[my] {
+			dx := float64(mx) + 0.5 - float64(modules)/2
+			dy := float64(my) + 0.5 - float64(modules)/2
+			if isFinderModule(mx, my, symbol, quietZone) || dx*normalX+dy*normalY < 0 {
+				colors[my][mx] = first
+			} else {
+				colors[my][mx] = second
+			}
+		}
+	}
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	modulesPerPixel := float64(modules) / float64(bounds.Dx())
+
+	for y := 0; y < bounds.Dy(); y++ {
+		my := int(float64(y) * modulesPerPixel)
+		for x := 0; x < bounds.Dx(); x++ {
+			mx := int(float64(x) * modulesPerPixel)
+			if isForeground(img.At(x, y), fg) {
+				result.Set(x, y, colors[my][mx])
+			} else {
+				result.Set(x, y, img.At(x, y))
+			}
+		}
+	}
+
+	return result
+}
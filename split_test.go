@@ -0,0 +1,31 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestSplitColorsDecode(t *testing.T) {
+	for _, angle := range []float64{0, 45, 90, 135} {
+		options := testOptions("https://example.com/split")
+		options.SplitColors = "rgb(26,35,126);rgb(183,28,28)"
+		options.SplitAngle = angle
+		img := renderCode(t, options)
+
+		// Both colors appear, and the code still reads
+		first, second, _ := parseSplitColors(options.SplitColors)
+		var sawFirst, sawSecond bool
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.RGBAModel.Convert(img.At(x, y))
+				sawFirst = sawFirst || c == color.RGBAModel.Convert(first)
+				sawSecond = sawSecond || c == color.RGBAModel.Convert(second)
+			}
+		}
+		if !sawFirst || !sawSecond {
+			t.Errorf("split_angle=%g: first color drawn %t, second %t", angle, sawFirst, sawSecond)
+		}
+		assertDecodes(t, img, options.Data)
+	}
+}
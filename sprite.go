@@ -0,0 +1,354 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"maps"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxSpriteItems bounds the number of codes packed into one sprite sheet
+const maxSpriteItems = 256
+
+// maxSpriteBodySize bounds the size of a sprite sheet request
+const maxSpriteBodySize = 1024 * 1024
+
+// spriteRequest is the body of POST /generate/sprite. Options are shared by every
+// item, and each item overrides them with its own fields.
+type spriteRequest struct {
+	Options  json.RawMessage   `json:"options"`
+	Items    []json.RawMessage `json:"items"`
+	CellSize int               `json:"cell_size"`
+	Columns  int               `json:"columns"`
+	Spacing  int               `json:"spacing"`
+
+	VersionScale bool   `json:"version_scale"` // encodes every item at the largest version any item needs
+	Partial      bool   `json:"partial"`       // leaves failing items out instead of failing the request
+	Files        string `json:"files"`         // filename pattern writing every code to codes/ as well, e.g. "{index}-{hash}.png"
+}
+
+// spriteEntry locates one code inside the sprite sheet
+type spriteEntry struct {
+	Index   int    `json:"index"`
+	Data    string `json:"data"`
+	Version int    `json:"version"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	File    string `json:"file,omitempty"`   // path of the code's own PNG with files
+	Status  string `json:"status,omitempty"` // "ok" or "error" with partial
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"` // stable error code, as in error responses
+}
+
+// spriteManifest describes the sheet layout so clients can address codes by offset
+type spriteManifest struct {
+	Width    int           `json:"width"`
+	Height   int           `json:"height"`
+	CellSize int           `json:"cell_size"`
+	Columns  int           `json:"columns"`
+	Rows     int           `json:"rows"`
+	Spacing  int           `json:"spacing"`
+	Version  int           `json:"version,omitempty"` // version shared by every item with version_scale
+	Failed   int           `json:"failed,omitempty"`  // number of items left out with partial
+	Items    []spriteEntry `json:"items"`
+}
+
+// decodeItems merges each item over the shared options and prepares it for rendering at size
+func decodeItems(c *fiber.Ctx, shared json.RawMessage, items []json.RawMessage, size int) ([]QRCodeOptions, error) {
+	prepared, errs, err := prepareItems(c, shared, items, size)
+	if err != nil {
+		return nil, err
+	}
+	return prepared, firstItemError(errs)
+}
+
+// prepareItems is decodeItems keeping going past failing items, whose errors it returns
+// by index. Only invalid shared options fail the whole batch. The request's API key
+// exempts every item from the watermark, and ec_overlay needs debug=true, as on GET /generate.
+func prepareItems(c *fiber.Ctx, shared json.RawMessage, items []json.RawMessage, size int) ([]QRCodeOptions, []error, error) {
+	base := defaultOptions
+	if len(shared) > 0 {
+		if err := json.Unmarshal(shared, &base); err != nil {
+			return nil, nil, fiber.NewError(400, "options must be a JSON object of options")
+		}
+	}
+	base.Size = size
+	base.noWatermark = watermarkExempt(c.Get("X-API-Key"))
+	debug := c.QueryBool("debug")
+
+	prepared := make([]QRCodeOptions, len(items))
+	errs := make([]error, len(items))
+	for i, raw := range items {
+		options := base
+		if err := json.Unmarshal(raw, &options); err != nil {
+			errs[i] = fiber.NewError(400, "item must be a JSON object of options")
+			continue
+		}
+		options.Format = "png"
+		if _, err := prepareOptions(&options); err != nil {
+			errs[i] = err
+		}
+		if !debug {
+			options.ECOverlay = false
+		}
+		prepared[i] = options
+	}
+	return prepared, errs, nil
+}
+
+// itemVersions returns the symbol version each item's data needs, recording in errs the
+// items whose data does not fit. Items that already failed are skipped.
+func itemVersions(items []QRCodeOptions, errs []error) []int {
+	versions := make([]int, len(items))
+	for i, options := range items {
+		if errs[i] != nil {
+			continue
+		}
+		qr, err := newQRCode(options)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		versions[i] = qr.VersionNumber
+	}
+	return versions
+}
+
+// scaleVersions pins every item to the largest of the versions, so codes sharing a cell
+// size and border also share a module size; the encoder pads shorter data. It returns
+// the chosen version.
+func scaleVersions(items []QRCodeOptions, versions []int) int {
+	version := slices.Max(versions)
+	for i := range items {
+		items[i].version = version
+		versions[i] = version
+	}
+	return version
+}
+
+// itemError prefixes an error with the index of the batch item that caused it
+func itemError(index int, err error) error {
+	status, message := itemFailure(err)
+	return fiber.NewError(status, fmt.Sprintf("item %d: %s", index, message))
+}
+
+// itemFailure returns the status code and message reported for a failing batch item
+func itemFailure(err error) (int, string) {
+	if e, ok := err.(*fiber.Error); ok {
+		return e.Code, e.Message
+	}
+	return 500, err.Error()
+}
+
+// firstItemError returns the error of the first failing item, if any
+func firstItemError(errs []error) error {
+	for i, err := range errs {
+		if err != nil {
+			return itemError(i, err)
+		}
+	}
+	return nil
+}
+
+// batchSlots is a global semaphore bounding the number of batch items rendered at once,
+// so concurrent batch requests share the configured workers instead of multiplying them
+var batchSlots = make(chan struct{}, runtime.NumCPU())
+
+// initBatchWorkers sizes the batch render semaphore from the configuration
+func initBatchWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	batchSlots = make(chan struct{}, workers)
+}
+
+// generateItems renders the items concurrently on up to cap(batchSlots) workers, keeping
+// the order of the input. When several items fail, the error of the first one is returned.
+func generateItems(items []QRCodeOptions) ([]image.Image, error) {
+	errs := make([]error, len(items))
+	images := renderItems(items, errs)
+	if err := firstItemError(errs); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// renderItems is generateItems recording each item's error in errs. Items that already
+// failed are skipped, leaving their image nil.
+func renderItems(items []QRCodeOptions, errs []error) []image.Image {
+	images := make([]image.Image, len(items))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(cap(batchSlots), len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if errs[i] != nil {
+					continue
+				}
+				batchSlots <- struct{}{}
+				images[i], _, errs[i] = generateImage(items[i], nil, nil)
+				<-batchSlots
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return images
+}
+
+// handleSprite serves POST /generate/sprite, packing many codes into a single sheet and
+// returning a ZIP holding sheet.png and manifest.json with each code's pixel offset.
+// With files, every code is also stored on its own under codes/, named by the pattern.
+// With partial, failing items leave their cell empty and are reported in the manifest,
+// answered with 207 Multi-Status when any failed.
+func handleSprite(c *fiber.Ctx) error {
+	req := spriteRequest{CellSize: 128}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(400, "Body must be a JSON sprite request")
+	}
+
+	if len(req.Items) == 0 || len(req.Items) > maxSpriteItems {
+		return fiber.NewError(400, fmt.Sprintf("items must contain between 1 and %d entries", maxSpriteItems))
+	}
+	if req.CellSize < 21 || req.CellSize > 1024 {
+		return fiber.NewError(400, "cell_size must be between 21 and 1024")
+	}
+	if req.Spacing < 0 || req.Spacing > 256 {
+		return fiber.NewError(400, "spacing must be between 0 and 256")
+	}
+	if req.Columns <= 0 {
+		req.Columns = int(math.Ceil(math.Sqrt(float64(len(req.Items)))))
+	}
+	req.Columns = min(req.Columns, len(req.Items))
+	if req.Files != "" {
+		if err := validateFilePattern(req.Files); err != nil {
+			return err
+		}
+	}
+
+	items, errs, err := prepareItems(c, req.Options, req.Items, req.CellSize)
+	if err != nil {
+		return err
+	}
+	versions := itemVersions(items, errs)
+	if err := firstItemError(errs); err != nil && !req.Partial {
+		return err
+	}
+	var version int
+	if req.VersionScale {
+		version = scaleVersions(items, versions)
+	}
+
+	images := renderItems(items, errs)
+	if err := firstItemError(errs); err != nil && !req.Partial {
+		return err
+	}
+
+	rows := (len(images) + req.Columns - 1) / req.Columns
+	manifest := spriteManifest{
+		Width:    req.Columns*req.CellSize + (req.Columns-1)*req.Spacing,
+		Height:   rows*req.CellSize + (rows-1)*req.Spacing,
+		CellSize: req.CellSize,
+		Columns:  req.Columns,
+		Rows:     rows,
+		Spacing:  req.Spacing,
+		Version:  version,
+	}
+
+	sheet := image.NewRGBA(image.Rect(0, 0, manifest.Width, manifest.Height))
+	files := map[string]image.Image{}
+	for i, img := range images {
+		x := (i % req.Columns) * (req.CellSize + req.Spacing)
+		y := (i / req.Columns) * (req.CellSize + req.Spacing)
+		if errs[i] != nil {
+			status, message := itemFailure(errs[i])
+			code, message := localizeError(status, message, requestLanguage(c))
+			manifest.Failed++
+			manifest.Items = append(manifest.Items, spriteEntry{
+				Index: i, Data: items[i].Data, X: x, Y: y,
+				Status: "error", Error: message, Code: code,
+			})
+			continue
+		}
+
+		// Decorations such as rings or cards enlarge the image, so fit it back into the cell
+		if img.Bounds().Dx() != req.CellSize || img.Bounds().Dy() != req.CellSize {
+			img = imaging.Fit(img, req.CellSize, req.CellSize, imaging.Lanczos)
+		}
+		size := img.Bounds().Size()
+		draw.Draw(sheet, image.Rect(x, y, x+size.X, y+size.Y), img, img.Bounds().Min, draw.Src)
+
+		entry := spriteEntry{
+			Index: i, Data: items[i].Data, Version: versions[i],
+			X: x, Y: y, Width: size.X, Height: size.Y,
+		}
+		if req.Partial {
+			entry.Status = "ok"
+		}
+		if req.Files != "" {
+			// Identical items render identical codes, so a shared name is written once
+			entry.File = "codes/" + itemFilename(req.Files, i, len(images), items[i])
+			files[entry.File] = img
+		}
+		manifest.Items = append(manifest.Items, entry)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	sheetFile, err := archive.Create("sheet.png")
+	if err == nil {
+		err = png.Encode(sheetFile, sheet)
+	}
+	if err != nil {
+		return fiber.NewError(500, "Failed to encode sprite sheet")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		file, err := archive.Create(name)
+		if err == nil {
+			err = png.Encode(file, files[name])
+		}
+		if err != nil {
+			return fiber.NewError(500, "Failed to encode sprite sheet")
+		}
+	}
+
+	manifestFile, err := archive.Create("manifest.json")
+	if err == nil {
+		err = json.NewEncoder(manifestFile).Encode(manifest)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		return fiber.NewError(500, "Failed to encode sprite manifest")
+	}
+
+	if manifest.Failed > 0 {
+		c.Vary(fiber.HeaderAcceptLanguage)
+		c.Status(fiber.StatusMultiStatus)
+	}
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", `attachment; filename="sprite.zip"`)
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// batchItems returns n prepared items with distinct data
+func batchItems(b testing.TB, n int) []QRCodeOptions {
+	items := make([]QRCodeOptions, n)
+	for i := range items {
+		items[i] = testOptions(fmt.Sprintf("https://example.com/item/%d", i))
+		items[i].Size = 512
+		if _, err := prepareOptions(&items[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return items
+}
+
+func TestRenderItemsKeepsOrder(t *testing.T) {
+	initBatchWorkers(4)
+	defer initBatchWorkers(runtime.NumCPU())
+
+	items := batchItems(t, 12)
+	images, err := generateItems(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, img := range images {
+		assertDecodes(t, img, items[i].Data)
+	}
+}
+
+func TestPrepareItemsGatesECOverlay(t *testing.T) {
+	for _, query := range []string{"", "?debug=true"} {
+		var prepared []QRCodeOptions
+		app := fiber.New()
+		app.Post("/", func(c *fiber.Ctx) error {
+			items := []json.RawMessage{json.RawMessage(`{"data":"a","ec_overlay":true}`)}
+			var err error
+			prepared, _, err = prepareItems(c, json.RawMessage(`{"ec_overlay":true}`), items, 256)
+			return err
+		})
+		if _, err := app.Test(httptest.NewRequest("POST", "/"+query, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if want := query != ""; prepared[0].ECOverlay != want {
+			t.Errorf("query %q: ec_overlay = %t, want %t", query, prepared[0].ECOverlay, want)
+		}
+	}
+}
+
+// BenchmarkRenderItems compares rendering a batch on one worker with rendering it on
+// one worker per CPU
+func BenchmarkRenderItems(b *testing.B) {
+	defer initBatchWorkers(runtime.NumCPU())
+	items := batchItems(b, 32)
+
+	for _, workers := range []int{1, max(runtime.NumCPU(), 2)} {
+		name := "sequential"
+		if workers > 1 {
+			name = fmt.Sprintf("concurrent-%d", workers)
+		}
+		b.Run(name, func(b *testing.B) {
+			initBatchWorkers(workers)
+			for range b.N {
+				if _, err := generateItems(items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
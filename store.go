@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errNotFound is returned by a Store when a key does not exist
+var errNotFound = errors.New("not found")
+
+// errStoreFull is returned by a Store asked to save a new key while it holds its
+// maximum number of keys. Replacing the value of an existing key always succeeds.
+var errStoreFull = errors.New("store is full")
+
+// Store persists small values such as presets by key
+type Store interface {
+	Save(key string, value []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// newStore creates the backend selected by the configuration
+func newStore(cfg Config) (Store, error) {
+	switch cfg.StoreBackend {
+	case "memory":
+		return newMemoryStore(cfg.StoreMaxKeys), nil
+	case "file":
+		return newFileStore(cfg.StoreDir, cfg.StoreMaxKeys)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.StoreBackend)
+	}
+}
+
+// storeFailure turns an error from a Store into the response to send, with message
+// describing what failed
+func storeFailure(err error, message string) error {
+	if errors.Is(err, errStoreFull) {
+		return fiber.NewError(fiber.StatusInsufficientStorage, "Store is full")
+	}
+	return fiber.NewError(500, message)
+}
+
+// memoryStore keeps values in process memory; it is not shared between instances
+type memoryStore struct {
+	mu      sync.RWMutex
+	values  map[string][]byte
+	maxKeys int // 0 means unbounded
+}
+
+func newMemoryStore(maxKeys int) *memoryStore {
+	return &memoryStore{values: make(map[string][]byte), maxKeys: maxKeys}
+}
+
+func (s *memoryStore) Save(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok && s.maxKeys > 0 && len(s.values) >= s.maxKeys {
+		return errStoreFull
+	}
+	s.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *memoryStore) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, errNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return errNotFound
+	}
+	delete(s.values, key)
+	return nil
+}
+
+// fileStore keeps one file per key in a directory, which instances can share over a common
+// volume. Instances saving new keys at the same moment may each pass the key bound, so the
+// directory can end up a few keys over it.
+type fileStore struct {
+	dir     string
+	maxKeys int // 0 means unbounded
+}
+
+func newFileStore(dir string, maxKeys int) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir, maxKeys: maxKeys}, nil
+}
+
+// path maps a key to a file name; hex encoding keeps arbitrary keys inside the directory
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(key)))
+}
+
+// full reports whether saving key would add a key beyond the bound
+func (s *fileStore) full(key string) (bool, error) {
+	if s.maxKeys <= 0 {
+		return false, nil
+	}
+	if _, err := os.Stat(s.path(key)); !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return false, err
+	}
+	keys := 0
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".tmp-") {
+			keys++
+		}
+	}
+	return keys >= s.maxKeys, nil
+}
+
+func (s *fileStore) Save(key string, value []byte) error {
+	full, err := s.full(key)
+	if err != nil {
+		return err
+	}
+	if full {
+		return errStoreFull
+	}
+
+	// Write to a temporary file first so readers never see a partial value
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *fileStore) Get(key string) ([]byte, error) {
+	value, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound
+	}
+	return value, err
+}
+
+func (s *fileStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return errNotFound
+	}
+	return err
+}
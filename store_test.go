@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	files, err := newFileStore(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]Store{"memory": newMemoryStore(2), "file": files} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Get("a"); !errors.Is(err, errNotFound) {
+				t.Fatalf("Get of a missing key: %v, want errNotFound", err)
+			}
+			if err := s.Delete("a"); !errors.Is(err, errNotFound) {
+				t.Fatalf("Delete of a missing key: %v, want errNotFound", err)
+			}
+
+			value := []byte("first")
+			if err := s.Save("a", value); err != nil {
+				t.Fatal(err)
+			}
+			// The store keeps its own copy of the value, and hands out copies
+			value[0] = 'X'
+			got, err := s.Get("a")
+			if err != nil || string(got) != "first" {
+				t.Fatalf("Get: %q, %v", got, err)
+			}
+			got[0] = 'Y'
+			if again, _ := s.Get("a"); string(again) != "first" {
+				t.Errorf("value changed through a returned slice: %q", again)
+			}
+
+			if err := s.Save("a", []byte("second")); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := s.Get("a"); !bytes.Equal(got, []byte("second")) {
+				t.Errorf("Get after replacing: %q", got)
+			}
+
+			// A new key past the bound is refused, while existing keys can still change
+			if err := s.Save("b", nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Save("c", nil); !errors.Is(err, errStoreFull) {
+				t.Errorf("Save of a third key: %v, want errStoreFull", err)
+			}
+			if err := s.Save("b", []byte("kept")); err != nil {
+				t.Errorf("replacing a key in a full store: %v", err)
+			}
+
+			if err := s.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get("a"); !errors.Is(err, errNotFound) {
+				t.Errorf("Get after Delete: %v, want errNotFound", err)
+			}
+			if err := s.Save("c", nil); err != nil {
+				t.Errorf("Save after a Delete freed room: %v", err)
+			}
+		})
+	}
+}
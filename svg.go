@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// svgNumber formats a coordinate with at most four decimals
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
+
+// svgGradient returns the gradient definition used as the module fill, laid out over the
+// whole modules x modules square in user space to match the raster gradient
+func svgGradient(options QRCodeOptions, modules int, bg color.Color) string {
+	start, end, _ := gradientColors(options, bg)
+	stops := fmt.Sprintf(`<stop offset="0" stop-color="%s"/><stop offset="1" stop-color="%s"/>`, hexColor(start), hexColor(end))
+	center := float64(modules) / 2
+
+	if options.GradientType == "radial" {
+		return fmt.Sprintf(`<defs><radialGradient id="fg" gradientUnits="userSpaceOnUse" cx="%s" cy="%s" r="%s">%s</radialGradient></defs>`,
+			svgNumber(center), svgNumber(center), svgNumber(center*math.Sqrt2), stops)
+	}
+
+	// The normalized vector scales to the modules square
+	v, m := gradientDirection(options), float64(modules)
+	return fmt.Sprintf(`<defs><linearGradient id="fg" gradientUnits="userSpaceOnUse" x1="%s" y1="%s" x2="%s" y2="%s">%s</linearGradient></defs>`,
+		svgNumber(v.x1*m), svgNumber(v.y1*m), svgNumber(v.x2*m), svgNumber(v.y2*m), stops)
+}
+
+// maxEmbeddedLogoSize bounds the PNG an SVG embeds, as it is copied into every response
+// and grows by a third as base64
+const maxEmbeddedLogoSize = 1024 * 1024
+
+// svgLogo returns the elements drawing the logo centered over the modules: its backing
+// plate filled with plateColor, and the PNG itself as a data URI. The logo is laid out in
+// pixels exactly like the raster path, but embedded at its own resolution so it stays
+// sharp when the SVG is scaled; only a tinted logo is re-encoded.
+func svgLogo(options QRCodeOptions, modules int, plateColor color.Color) (plate, logo string, err error) {
+	data, err := fetchLimited(publicClient, options.LogoURL, maxEmbeddedLogoSize)
+	if err != nil {
+		return "", "", err
+	}
+	img, err := decodeFetchedPNG(data)
+	if err != nil {
+		return "", "", err
+	}
+	if options.LogoTint != "" {
+		tinted := tintLogo(img, parseColor(options.LogoTint), options.LogoTintMode)
+		if data, err = encodePNG(tinted); err != nil {
+			return "", "", err
+		}
+		img = tinted
+	}
+
+	box := int(float64(options.Size) * options.LogoSize / 100)
+	fitted := fitLogo(img, box, box)
+	size := fitted.Bounds().Size()
+	x, y := (options.Size-size.X)/2, (options.Size-size.Y)/2
+	logoPos := image.Rect(x, y, x+size.X, y+size.Y)
+	unit := float64(modules) / float64(options.Size)
+
+	switch options.LogoPlate {
+	case "box":
+		box := opaqueBounds(fitted).Add(logoPos.Min).Inset(-options.LogoPadding)
+		plate = fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`,
+			svgNumber(float64(box.Min.X)*unit), svgNumber(float64(box.Min.Y)*unit),
+			svgNumber(float64(box.Dx())*unit), svgNumber(float64(box.Dy())*unit), hexColor(plateColor))
+	case "silhouette":
+		// The dilated outline has no vector form, so the plate is a raster at the output size
+		mask := silhouetteMask(fitted, options.LogoPadding)
+		silhouette := image.NewNRGBA(mask.Bounds())
+		draw.DrawMask(silhouette, silhouette.Bounds(), image.NewUniform(plateColor), image.Point{}, mask, image.Point{}, draw.Src)
+		plateData, err := encodePNG(silhouette)
+		if err != nil {
+			return "", "", err
+		}
+		plate = svgImage(logoPos.Inset(-options.LogoPadding), unit, plateData)
+	}
+	return plate, svgImage(logoPos, unit, data), nil
+}
+
+// svgImage returns an image element showing the PNG data stretched over the pixel
+// rectangle. Only xlink:href is written, as every renderer reads it and repeating the
+// data URI in href would double its size.
+func svgImage(r image.Rectangle, unit float64, data []byte) string {
+	return fmt.Sprintf(`<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none" xlink:href="data:image/png;base64,%s"/>`,
+		svgNumber(float64(r.Min.X)*unit), svgNumber(float64(r.Min.Y)*unit),
+		svgNumber(float64(r.Dx())*unit), svgNumber(float64(r.Dy())*unit),
+		base64.StdEncoding.EncodeToString(data))
+}
+
+// encodePNG returns the image encoded as PNG
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG renders the code as an SVG with one path covering every dark module.
+// Runs of adjacent dark modules in a row are merged to keep the path short. A logo is
+// embedded over the modules as a raster image, and a transparent plate masks the modules
+// and background out beneath it.
+func renderSVG(qr *qrcode.QRCode, options QRCodeOptions) ([]byte, error) {
+	bitmap := moduleMatrix(qr, options.Border)
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	// Every caption adds a strip below the modules, sized in pixels and converted to module units
+	lines := captions(options)
+	strip := len(lines) * labelStripHeight(options.LabelSize)
+	unit := float64(modules) / float64(options.Size)
+	viewHeight := svgNumber(float64(modules) + float64(strip)*unit)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %s">`,
+		options.Size, options.Size+strip, modules, viewHeight)
+
+	// Make the whole code clickable when embedded inline; both attributes cover old and new renderers
+	if options.SVGLink {
+		var href strings.Builder
+		xml.EscapeText(&href, []byte(options.Data))
+		fmt.Fprintf(&b, `<a href="%s" xlink:href="%s" target="_blank">`, href.String(), href.String())
+	}
+	var plate, logo string
+	if options.LogoURL != "" {
+		// A mask hides whatever is painted black in it, so a cut-out plate is drawn in black
+		plateColor := qr.BackgroundColor
+		if options.LogoPlateTransparent {
+			plateColor = color.Black
+		}
+		var err error
+		plate, logo, err = svgLogo(options, modules, plateColor)
+		if err != nil {
+			return nil, fetchFailure(err, "logo_url", "Failed to embed logo")
+		}
+	}
+	knockout := options.LogoPlateTransparent && plate != ""
+	if knockout {
+		fmt.Fprintf(&b, `<defs><mask id="knockout" maskUnits="userSpaceOnUse"><rect width="%d" height="%s" fill="#ffffff"/>%s</mask></defs><g mask="url(#knockout)">`,
+			modules, viewHeight, plate)
+	}
+	fmt.Fprintf(&b, `<rect width="%d" height="%s" fill="%s"/>`, modules, viewHeight, hexColor(qr.BackgroundColor))
+	fill := hexColor(qr.ForegroundColor)
+	if options.GradientStart != "" && options.GradientEnd != "" {
+		b.WriteString(svgGradient(options, modules, qr.BackgroundColor))
+		fill = "url(#fg)"
+	}
+	fmt.Fprintf(&b, `<path d="%s" fill="%s" shape-rendering="crispEdges"/>`, path.String(), fill)
+	if knockout {
+		b.WriteString(`</g>`)
+	} else {
+		b.WriteString(plate)
+	}
+	b.WriteString(logo)
+	labelColor := qr.ForegroundColor
+	if options.LabelColor != "" {
+		labelColor = parseColor(options.LabelColor)
+	}
+	lineHeight := float64(labelStripHeight(options.LabelSize)) * unit
+	for _, line := range lines {
+		// Downloaded fonts are not installed where the SVG is viewed, so they travel with it
+		if line.embed != nil {
+			fmt.Fprintf(&b, `<defs><style>@font-face{font-family:"qr-caption";src:url(data:font/ttf;base64,%s)}</style></defs>`,
+				base64.StdEncoding.EncodeToString(line.embed))
+		}
+	}
+	for i, line := range lines {
+		var text strings.Builder
+		xml.EscapeText(&text, []byte(line.text))
+		direction := "ltr"
+		if line.rtl {
+			direction = "rtl"
+		}
+		fmt.Fprintf(&b, `<text x="%s" y="%s" font-family="%s" font-size="%s" fill="%s" text-anchor="middle" dominant-baseline="central" direction="%s">%s</text>`,
+			svgNumber(float64(modules)/2),
+			svgNumber(float64(modules)+(float64(i)+0.5)*lineHeight),
+			line.family,
+			svgNumber(options.LabelSize*unit),
+			hexColor(labelColor), direction, text.String())
+	}
+	if options.SVGLink {
+		b.WriteString(`</a>`)
+	}
+	b.WriteString(`</svg>`)
+
+	return []byte(b.String()), nil
+}
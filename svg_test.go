@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSVGRejectsLargeLogos(t *testing.T) {
+	// Noise does not compress, so the PNG is above maxEmbeddedLogoSize
+	rng := rand.New(rand.NewSource(1))
+	noise := image.NewNRGBA(image.Rect(0, 0, 600, 600))
+	rng.Read(noise.Pix)
+	logo := serveImage(t, noise)
+
+	for _, format := range []string{"svg", "png"} {
+		options := testOptions("https://example.com")
+		options.Error = "H"
+		options.Format = format
+		options.LogoURL = logo
+		if _, err := prepareOptions(&options); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := renderOutput(options, nil)
+		var fiberErr *fiber.Error
+		rejected := errors.As(err, &fiberErr) && fiberErr.Code == 400
+		if rejected != (format == "svg") {
+			t.Errorf("%s: render returned %v", format, err)
+		}
+	}
+}
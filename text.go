@@ -0,0 +1,35 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// textFace is the font used for all raster text
+var textFace font.Face = basicfont.Face7x13
+
+// textWidth returns the rendered width of text in pixels
+func textWidth(text string) int {
+	return font.MeasureString(textFace, text).Ceil()
+}
+
+// textHeight returns the line height of the text face in pixels
+func textHeight() int {
+	return textFace.Metrics().Height.Ceil()
+}
+
+// drawText draws text with its top-left corner at (x, y)
+func drawText(dst draw.Image, text string, x, y int, c color.Color) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: textFace,
+		Dot:  fixed.P(x, y+textFace.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+)
+
+// applyModuleImage stamps the tile, scaled to the module size, over every dark module of
+// the bitmap. Finder patterns stay solid so the code stays easy to locate.
+func applyModuleImage(img image.Image, bitmap [][]bool, quietZone int, bg color.Color, tile image.Image) *image.RGBA {
+	modules := len(bitmap)
+	symbol := modules - 2*quietZone
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+
+	// Module edges fall on whole pixels, so modules differ by at most a pixel; scale once per size
+	scaled := map[image.Point]image.Image{}
+	background := image.NewUniform(bg)
+	size := bounds.Dx()
+	for my, row := range bitmap {
+		for mx, dark := range row {
+			if !dark || isFinderModule(mx, my, symbol, quietZone) {
+				continue
+			}
+			rect := image.Rect(mx*size/modules, my*size/modules, (mx+1)*size/modules, (my+1)*size/modules)
+			if rect.Empty() {
+				continue
+			}
+			stamp, ok := scaled[rect.Size()]
+			if !ok {
+				stamp = imaging.Resize(tile, rect.Dx(), rect.Dy(), imaging.Lanczos)
+				scaled[rect.Size()] = stamp
+			}
+			draw.Draw(result, rect, background, image.Point{}, draw.Src)
+			draw.Draw(result, rect, stamp, image.Point{}, draw.Over)
+		}
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestModuleImageDecodes(t *testing.T) {
+	// A dark tile with a lighter rim, which scanners sampling module centers still read as dark
+	tile := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			c := color.NRGBA{R: 20, G: 40, B: 90, A: 255}
+			if x < 2 || y < 2 || x >= 14 || y >= 14 {
+				c = color.NRGBA{R: 90, G: 120, B: 180, A: 255}
+			}
+			tile.SetNRGBA(x, y, c)
+		}
+	}
+
+	options := testOptions("https://example.com/tiles")
+	options.ModuleImageURL = serveImage(t, tile)
+	options.Size = 580
+	img := renderCode(t, options)
+
+	// The tile replaces the plain module color outside the finder patterns
+	tinted := false
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y && !tinted; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X && !tinted; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			tinted = r>>8 == 20 && g>>8 == 40 && b>>8 == 90
+		}
+	}
+	if !tinted {
+		t.Error("no module shows the tile")
+	}
+	assertDecodes(t, img, options.Data)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stageTimer records how long each stage of a request takes.
+// A nil *stageTimer is valid and records nothing.
+type stageTimer struct {
+	start  time.Time
+	last   time.Time
+	stages []string
+}
+
+// newStageTimer starts timing from now
+func newStageTimer() *stageTimer {
+	now := time.Now()
+	return &stageTimer{start: now, last: now}
+}
+
+// mark records the time spent since the previous mark under the given stage name
+func (t *stageTimer) mark(stage string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.stages = append(t.stages, fmt.Sprintf("%s=%s", stage, formatDuration(now.Sub(t.last))))
+	t.last = now
+}
+
+// String lists every recorded stage followed by the total, e.g. "encode=1.20ms, total=1.35ms"
+func (t *stageTimer) String() string {
+	if t == nil {
+		return ""
+	}
+	return strings.Join(append(t.stages, "total="+formatDuration(time.Since(t.start))), ", ")
+}
+
+// formatDuration renders a duration in milliseconds with two decimals
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d.Microseconds())/1000)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newEditToken returns a random edit token and the hash stored in its place
+func newEditToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashEditToken(token), nil
+}
+
+// hashEditToken returns the hex SHA-256 of an edit token
+func hashEditToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkEditToken fails unless the request carries, in header, the token whose hash is
+// stored for the named resource. An empty hash matches no token.
+func checkEditToken(c *fiber.Ctx, header, hash, resource string) error {
+	token := c.Get(header)
+	if token == "" {
+		return fiber.NewError(401, header+" is required to edit a "+resource)
+	}
+	if hash == "" || subtle.ConstantTimeCompare([]byte(hashEditToken(token)), []byte(hash)) != 1 {
+		return fiber.NewError(403, header+" does not match this "+resource)
+	}
+	return nil
+}
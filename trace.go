@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxTraceIDLength bounds the length of an embedded trace ID
+const maxTraceIDLength = 32
+
+// maxTraceSide bounds the width and height of an image POST /trace decodes. No render is
+// larger: layout=circular stops at maxLayoutSide, and a ring around it, labels, a card
+// and the bleed add less than the rest.
+const maxTraceSide = 2 * maxLayoutSide
+
+// traceMagic starts every embedded trace record
+const traceMagic = "QRID"
+
+// traceRecord returns the bytes embedded for a trace ID: the magic, one length byte, the
+// ID and the big-endian CRC-32 of the ID
+func traceRecord(id string) []byte {
+	record := append([]byte(traceMagic), byte(len(id)))
+	record = append(record, id...)
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE([]byte(id)))
+}
+
+// embedTraceID hides the trace record in the least significant bit of the blue channel of
+// the fully opaque pixels in the top rows of the image, which must lie above every module.
+// Extraction reads the pixels row by row from the top-left corner, skips any that are not
+// fully opaque, and collects the blue bits most significant first; readTraceID does this.
+func embedTraceID(img image.Image, id string, rows int) (*image.RGBA, error) {
+	result := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	record := traceRecord(id)
+	bit := 0
+	for y := 0; y < min(rows, result.Rect.Dy()) && bit < 8*len(record); y++ {
+		for x := 0; x < result.Rect.Dx() && bit < 8*len(record); x++ {
+			offset := result.PixOffset(x, y)
+			if result.Pix[offset+3] != 0xff {
+				continue
+			}
+			value := record[bit/8] >> (7 - bit%8) & 1
+			result.Pix[offset+2] = result.Pix[offset+2]&^1 | value
+			bit++
+		}
+	}
+	if bit < 8*len(record) {
+		return nil, fiber.NewError(400, fmt.Sprintf("trace_id needs %d opaque pixels above the code but only %d are free; increase border or size", 8*len(record), bit))
+	}
+	return result, nil
+}
+
+// readTraceID recovers a trace ID embedded by embedTraceID, reporting whether a valid
+// record was found. It stops as soon as the magic or length cannot start a record, or
+// the record's CRC has been read.
+func readTraceID(img image.Image) (string, bool) {
+	bounds := img.Bounds()
+	header := len(traceMagic) + 1
+	var record []byte
+	var current byte
+	bits := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, b, a := img.At(x, y).RGBA()
+			if a != 0xffff {
+				continue
+			}
+			current = current<<1 | byte(b>>8)&1
+			if bits++; bits%8 != 0 {
+				continue
+			}
+			record = append(record, current)
+			switch {
+			case len(record) == len(traceMagic) && string(record) != traceMagic:
+				return "", false
+			case len(record) == header && int(record[header-1]) > maxTraceIDLength:
+				return "", false
+			case len(record) > header && len(record) == header+int(record[header-1])+4:
+				id := record[header : len(record)-4]
+				if binary.BigEndian.Uint32(record[len(record)-4:]) != crc32.ChecksumIEEE(id) {
+					return "", false
+				}
+				return string(id), true
+			}
+		}
+	}
+	return "", false
+}
+
+// handleTrace serves POST /trace, reading the trace ID back out of a PNG body. The header
+// is checked first, so a small body cannot make the server decode a huge image.
+func handleTrace(c *fiber.Ctx) error {
+	cfg, err := png.DecodeConfig(bytes.NewReader(c.Body()))
+	if err != nil {
+		return fiber.NewError(400, "Body must be a PNG image")
+	}
+	if cfg.Width > maxTraceSide || cfg.Height > maxTraceSide {
+		return fiber.NewError(413, fmt.Sprintf("image is %dx%d pixels; no code this service renders exceeds %d on a side", cfg.Width, cfg.Height, maxTraceSide))
+	}
+	img, err := png.Decode(bytes.NewReader(c.Body()))
+	if err != nil {
+		return fiber.NewError(400, "Body must be a PNG image")
+	}
+	id, ok := readTraceID(img)
+	if !ok {
+		return fiber.NewError(404, "No trace ID found in the image")
+	}
+	return c.JSON(fiber.Map{"trace_id": id})
+}
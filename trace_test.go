@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// postTrace sends img to POST /trace, returning the status and the recovered ID
+func postTrace(t *testing.T, img image.Image) (int, string) {
+	t.Helper()
+	var body bytes.Buffer
+	if err := png.Encode(&body, img); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Post("/trace", handleTrace)
+	resp, err := app.Test(httptest.NewRequest("POST", "/trace", &body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		TraceID string `json:"trace_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded.TraceID
+}
+
+func TestTraceIDRoundTrip(t *testing.T) {
+	for _, id := range []string{"a", "order-1234", "0123456789abcdef0123456789abcdef"} {
+		options := testOptions("https://example.com/traced")
+		options.TraceID = id
+		img := renderCode(t, options)
+		if status, got := postTrace(t, img); status != 200 || got != id {
+			t.Errorf("trace_id %q: status %d, recovered %q", id, status, got)
+		}
+		// The hidden bits do not disturb the code
+		assertDecodes(t, img, options.Data)
+	}
+
+	if status, _ := postTrace(t, renderCode(t, testOptions("https://example.com/traced"))); status != 404 {
+		t.Errorf("untraced image: status %d, want 404", status)
+	}
+}
+
+func TestTraceRejectsOversizedImages(t *testing.T) {
+	// Cheap to encode and send, but wider than any render
+	if status, _ := postTrace(t, image.NewGray(image.Rect(0, 0, maxTraceSide+1, 1))); status != 413 {
+		t.Errorf("status %d, want 413", status)
+	}
+}
+
+func TestReadTraceIDRejectsCorruptRecords(t *testing.T) {
+	options := testOptions("https://example.com/traced")
+	options.TraceID = "order-1234"
+	img := renderCode(t, options).(*image.RGBA)
+
+	// Flipping a bit of the ID breaks the CRC
+	corrupt := image.NewRGBA(img.Rect)
+	copy(corrupt.Pix, img.Pix)
+	offset := corrupt.PixOffset(8*(len(traceMagic)+1)+3, 0)
+	corrupt.Pix[offset+2] ^= 1
+	if id, ok := readTraceID(corrupt); ok {
+		t.Errorf("corrupt record read as %q", id)
+	}
+}
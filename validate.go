@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handleValidate serves POST /validate, running a JSON object of options through the
+// same resolution and validation as GET /generate and encoding the symbol, without
+// rendering an image. Valid options answer 200 with the warnings generation would
+// report; invalid ones answer 400 with the error it would return.
+func handleValidate(c *fiber.Ctx) error {
+	options := defaultOptions
+	if err := json.Unmarshal(c.Body(), &options); err != nil {
+		return fiber.NewError(400, "Body must be a JSON object of options")
+	}
+
+	warnings, err := prepareOptions(&options)
+	if err != nil {
+		return err
+	}
+
+	// Encoding checks the data fits the error level, and the quiet zone depends on the symbol size
+	qr, err := newQRCode(options)
+	if err != nil {
+		return err
+	}
+	if sides, asymmetric := resolveSideBorders(options); asymmetric {
+		err = sides.validate(qr)
+	} else {
+		err = validateBorder(qr, options)
+	}
+	if err != nil {
+		return err
+	}
+
+	result := fiber.Map{
+		"valid":    true,
+		"warnings": append([]string{}, warnings...),
+		"version":  qr.VersionNumber,
+		"modules":  len(qr.Bitmap()),
+	}
+	if options.Type != "" || options.Vars != "" {
+		result["data"] = options.Data
+	}
+	if options.AutoType {
+		result["type"], _ = detectType(options.Data)
+	}
+	if options.LogoAutofit {
+		result["logo_size"] = options.LogoSize
+	}
+	if options.DPI > 0 {
+		result["module_size"] = options.modulePixels
+		result["module_mm"] = moduleMillimeters(options.modulePixels, options.DPI)
+	}
+	return c.JSON(result)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// applyVignette shades the background of img towards edge with a radial falloff from the
+// center, leaving every pixel that matches the foreground color of mask untouched. The
+// edge color is lightened like pattern colors so modules keep their contrast.
+func applyVignette(img, mask image.Image, fg, edge color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	edge = lightenPatternColor(edge)
+
+	centerX := float64(bounds.Min.X+bounds.Max.X) / 2
+	centerY := float64(bounds.Min.Y+bounds.Max.Y) / 2
+	maxDistance := math.Hypot(float64(bounds.Dx())/2, float64(bounds.Dy())/2)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isForeground(mask.At(x, y), fg) {
+				result.Set(x, y, img.At(x, y))
+				continue
+			}
+			// Squaring the ratio keeps the center clear and concentrates the shading at the edges
+			ratio := math.Min(math.Hypot(float64(x)+0.5-centerX, float64(y)+0.5-centerY)/maxDistance, 1.0)
+			result.Set(x, y, mixColors(img.At(x, y), edge, ratio*ratio))
+		}
+	}
+
+	return result
+}
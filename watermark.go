@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// moduleBounds returns the bounding box of the pixels matching the foreground color of mask
+func moduleBounds(mask image.Image, fg color.Color) image.Rectangle {
+	bounds := mask.Bounds()
+	found := image.Rectangle{Min: bounds.Max, Max: bounds.Min}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isForeground(mask.At(x, y), fg) {
+				found = found.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return found
+}
+
+// applyWatermark draws the configured attribution text into a corner of the quiet zone.
+// When the quiet zone is too thin to hold the text a strip of background color is added
+// on that side, so the mark never covers modules.
+func applyWatermark(img, mask image.Image, fg, bg color.Color) image.Image {
+	text := config.WatermarkText
+	bounds := img.Bounds()
+	modules := moduleBounds(mask, fg)
+
+	const padding = 2
+	height := textHeight()
+	top := config.WatermarkPosition == "top-left" || config.WatermarkPosition == "top-right"
+
+	// Quiet zone available on the chosen side
+	margin := bounds.Max.Y - modules.Max.Y
+	if top {
+		margin = modules.Min.Y - bounds.Min.Y
+	}
+
+	// Extend the canvas when the text does not fit inside the quiet zone
+	extra := 0
+	if margin < height+2*padding {
+		extra = height + 2*padding - margin
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()+extra))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	offset := 0
+	if top {
+		offset = extra
+	}
+	draw.Draw(canvas, image.Rect(0, offset, bounds.Dx(), offset+bounds.Dy()), img, bounds.Min, draw.Src)
+
+	// Position the text inside the quiet zone strip of the chosen corner
+	x := canvas.Bounds().Dx() - textWidth(text) - padding*2
+	if config.WatermarkPosition == "top-left" || config.WatermarkPosition == "bottom-left" {
+		x = padding * 2
+	}
+	y := canvas.Bounds().Dy() - height - padding
+	if top {
+		y = padding
+	}
+
+	r, g, b, _ := color.NRGBAModel.Convert(fg).RGBA()
+	opacity := config.WatermarkOpacity
+	if opacity < 0 {
+		opacity = 0
+	} else if opacity > 1 {
+		opacity = 1
+	}
+	markColor := color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(opacity * 255)}
+
+	drawText(canvas, text, x, y, markColor)
+
+	return canvas
+}
+
+// watermarkExempt reports whether the request's API key skips the attribution mark
+func watermarkExempt(apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	for _, key := range config.WatermarkExemptKeys {
+		if key == apiKey {
+			return true
+		}
+	}
+	return false
+}